@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
+	"log"
 	"os"
 
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/server"
 )
 
@@ -13,6 +16,62 @@ func main() {
 		port = "8080"
 	}
 
+	// The STORE and STORE_PATH environment variables set the defaults, for running within containers
+	var defaultStore = os.Getenv("STORE")
+	if defaultStore == "" {
+		defaultStore = cache.RedisStore
+	}
+
+	var defaultStorePath = os.Getenv("STORE_PATH")
+	if defaultStorePath == "" {
+		defaultStorePath = "oa2b.db"
+	}
+
+	// STORE_FAILURE and RATELIMIT_FAILURE set how the components behave while the store is unavailable
+	var defaultStoreFailure = os.Getenv("STORE_FAILURE")
+	if defaultStoreFailure == "" {
+		defaultStoreFailure = string(cache.FailOpen)
+	}
+
+	var defaultLimiterFailure = os.Getenv("RATELIMIT_FAILURE")
+	if defaultLimiterFailure == "" {
+		defaultLimiterFailure = string(cache.FailOpen)
+	}
+
+	// HOUSEKEEPING sets the intervals of the housekeeping tasks
+	var defaultHousekeeping = os.Getenv("HOUSEKEEPING")
+
+	storeName := flag.String("store", defaultStore, "storage backend: redis, memory or file")
+	storePath := flag.String("store-path", defaultStorePath, "file to which the file storage backend persists")
+	storeFailureName := flag.String("store-failure", defaultStoreFailure,
+		"while Redis is unavailable, keep records in memory (open) or fail requests (closed)")
+	limiterFailureName := flag.String("ratelimit-failure", defaultLimiterFailure,
+		"while the store is unavailable, let requests through (open) or reject them (closed)")
+	housekeeping := flag.String("housekeeping", defaultHousekeeping,
+		"intervals of the housekeeping tasks, such as expiry=5m,compaction=5m,indexes=1h")
+	flag.Parse()
+
+	err := cache.ConfigureHousekeeping(*housekeeping)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storeFailure, err := cache.ParseFailurePolicy(*storeFailureName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	limiterFailure, err := cache.ParseFailurePolicy(*limiterFailureName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = cache.OpenStore(*storeName, *storePath, storeFailure)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	server := server.NewOA2Server(port, "config/flowParams.json", "config/ratePolicies.csv")
+	server.Limiter.Failure = limiterFailure
 	server.Start()
 }
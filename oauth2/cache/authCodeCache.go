@@ -2,97 +2,221 @@ package cache
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 const (
-	// Redis HSET which holds the issued tokens
+	// Set which holds the issued tokens
 	authCodeTokensSet = "OA2B_AC_Tokens"
 
-	// Redis HSET which holds the issued grants until a token request is made.
+	// Set which holds the issued grants until a token request is made.
 	authCodeGrantSet = "OA2B_AC_Grants"
 
+	// Set which remembers the grants exchanged for a token, so that replays are recognized
+	authCodeRedeemedSet = "OA2B_AC_RedeemedGrants"
+
+	// Seconds for which a redeemed grant is remembered
+	redeemedGrantLifetime = 3600
+
+	// Time within which a grant must be exchanged for a token
+	authCodeGrantLifetime = 10 * time.Minute
+
 	// AuthCodeFlowID is prepended to a refresh token issued by the Authorization Code flow
 	AuthCodeFlowID = "AUTHCODE"
 )
 
+// ErrAuthCodeReplayed is returned when an authorization grant which was already exchanged for a token
+// is presented again. The tokens issued on it have been revoked by then.
+var ErrAuthCodeReplayed = errors.New("authorization grant was already used, all tokens issued with it have been revoked")
+
 // AuthCodeToken represents a token issued by the Authorization Code flow
 // https://tools.ietf.org/html/rfc6749#section-4.1.3
 type AuthCodeToken struct {
 	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// AuthCodeGrant holds the parameters of an authorization request which must be
+// remembered until the authorization grant is exchanged for a token.
+//
+// RedirectURIDefaulted is set if the client omitted the redirect URI from the authorization request,
+// in which case the only one it registered was used and it need not be sent in the token request.
+// Nonce is the OpenID Connect nonce which must be included in the ID token.
+// Subject identifies the resource owner who authorized the request, at AuthTime.
+// Lifetimes are those of the tokens issued to the client.
+// The token family is carried over on refresh requests, which are served by issuing an internal grant.
+type AuthCodeGrant struct {
+	ClientID             string    `json:"client_id"`
+	RedirectURI          string    `json:"redirect_uri"`
+	RedirectURIDefaulted bool      `json:"redirect_uri_defaulted,omitempty"`
+	Scope                string    `json:"scope,omitempty"`
+	Nonce                string    `json:"nonce,omitempty"`
+	Subject              string    `json:"subject,omitempty"`
+	CodeChallenge        string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod  string    `json:"code_challenge_method,omitempty"`
+	AuthTime             time.Time `json:"auth_time"`
+	CreationTime         time.Time `json:"creation_time"`
+
+	Lifetimes config.TokenLifetimes `json:"lifetimes"`
+	refreshFamily
 }
 
 // Holds the meta data of an access token
 type authCodeTokenMeta struct {
-	AuthGrant    string    `json:"auth_grant"`
-	CreationTime time.Time `json:"creation_time"`
-	Nonce        string    `json:"nonce"`
+	AuthGrant              string    `json:"auth_grant"`
+	ClientID               string    `json:"client_id"`
+	Subject                string    `json:"subject,omitempty"`
+	Scope                  string    `json:"scope,omitempty"`
+	AuthTime               time.Time `json:"auth_time"`
+	CreationTime           time.Time `json:"creation_time"`
+	Nonce                  string    `json:"nonce"`
+	RefreshExpiresIn       int       `json:"refresh_expires_in,omitempty"`
+	RefreshAbsoluteExpires int       `json:"refresh_absolute_expires_in,omitempty"`
+	refreshFamily
+}
+
+// Holds an authorization grant which was exchanged for a token along with
+// the family of the tokens issued on it. Replayed is set once it is presented again.
+type redeemedAuthCodeGrant struct {
+	FamilyID   string    `json:"family_id"`
+	ClientID   string    `json:"client_id"`
+	RedeemedAt time.Time `json:"redeemed_at"`
+	Replayed   bool      `json:"replayed,omitempty"`
 }
 
 // Holds the token as well as its metadata.
-// It is the internal representation of the token inside the Redis cache.
+// It is the internal representation of the token inside the cache.
 type internalAuthCodeToken struct {
 	Token AuthCodeToken     `json:"token"`
 	Meta  authCodeTokenMeta `json:"meta"`
 }
 
 // NewAuthCodeToken issues new access tokens for the Authorization Code flow.
-// It searches for 'code' in the Redis cache and throws errors if not found.
+// It searches for 'code' in the cache and throws errors if not found.
 // If found, it checks if it has crossed is expiry limit which is 10 minutes.
 // If crossed, an error is thrown.
-// Else a new token is generated and returned.
+// If 'clientID' is set, the grant must have been issued to that client.
+// 'redirectURI' must match the one of the grant, unless the client omitted it from the authorization request.
+// If the grant was issued with a PKCE code challenge, 'codeVerifier' must match it.
+// If the grant was already exchanged, the tokens issued on it are revoked and ErrAuthCodeReplayed is returned.
+// Else a new token is generated and returned along with the grant it was issued for.
 // Refer RFC 6749 Section 4.1.2 (https://tools.ietf.org/html/rfc6749#section-4.1.2)
-func NewAuthCodeToken(code, refreshToken, redirectURI string) (*AuthCodeToken, error) {
-	// First check if such an authorization grant has been issued
-	conn := NewConn()
-	defer CloseConn(conn)
-
-	value := code + ":" + redirectURI
+// and RFC 7636 Section 4.6 (https://tools.ietf.org/html/rfc7636#section-4.6)
+func NewAuthCodeToken(code, refreshToken, redirectURI, codeVerifier, clientID string) (*AuthCodeToken, *AuthCodeGrant, error) {
+	// A grant is remembered as redeemed before it is removed, hence a replay is recognized
+	// even while the grant is still being exchanged
+	err := detectAuthCodeReplay(code)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	reply, err := redis.Int(conn.Do("HEXISTS", authCodeGrantSet, value))
+	// Then check if such an authorization grant has been issued
+	grantBytes, err := store.Get(authCodeGrantSet, code)
 	if err != nil {
 		log.Println("NewAuthCodeToken: " + err.Error())
-		return nil, err
+		return nil, nil, err
 	}
 
-	// If 'value' is not found in the Redis cache, there are the following possibilites:
-	// - A token was already issued on this authorization grant and must be revoked.
-	// - It has expired and was removed by housekeep().
+	// If 'code' is not found in the cache, there are the following possibilites:
+	// - A token was issued on this authorization grant long enough ago for it to be forgotten.
+	// - It has expired and was removed by the store.
 	// - It was never issued.
-	// - the redirect URI is wrong
-	if reply == 0 {
-		return nil, fmt.Errorf("recycled/expired/invalid authorization grant or wrong redirect_uri")
+	if grantBytes == nil {
+		return nil, nil, fmt.Errorf("recycled/expired/invalid authorization grant")
 	}
 
-	// If found, check if it has expired since housekeeping runs only every 5 minutes
-	intTime, err := redis.Int64(conn.Do("HGET", authCodeGrantSet, value))
+	var grant AuthCodeGrant
+	err = json.Unmarshal(grantBytes, &grant)
 	if err != nil {
 		log.Println("NewAuthCodeToken: " + err.Error())
-		return nil, err
+		return nil, nil, err
+	}
+
+	// If found, check if it has expired since the record outlives the grant
+	if time.Now().Sub(grant.CreationTime) >= authCodeGrantLifetime {
+		return nil, nil, fmt.Errorf("expired authorization grant")
+	}
+
+	if clientID != "" && grant.ClientID != clientID {
+		return nil, nil, fmt.Errorf("authorization grant was issued to another client")
 	}
 
-	issueTime := time.Unix(intTime, 0)
-	if time.Now().Sub(issueTime) >= 10*time.Minute {
-		return nil, fmt.Errorf("expired authorization grant")
+	// The redirect URI is only required if it was part of the authorization request, though it must match if sent
+	// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.3
+	if (redirectURI != "" || !grant.RedirectURIDefaulted) && redirectURI != grant.RedirectURI {
+		return nil, nil, fmt.Errorf("redirect_uri missing or does not match the authorization request")
+	}
+
+	// The verifier is checked before the grant is removed, so that a client
+	// may retry with the right verifier within the lifetime of the grant.
+	if grant.CodeChallenge == "" && codeVerifier != "" {
+		return nil, nil, fmt.Errorf("code_verifier sent for a grant issued without a code_challenge")
+	} else if grant.CodeChallenge != "" && !verifyCodeChallenge(codeVerifier, grant.CodeChallenge, grant.CodeChallengeMethod) {
+		return nil, nil, fmt.Errorf("code_verifier missing or does not match the code_challenge")
+	}
+
+	// Only grants issued at the authorization endpoint can be replayed,
+	// the ones issued internally for refresh requests never leave the server.
+	// Of several concurrent requests with the same grant, a single one manages to mark it as redeemed,
+	// the others are replays.
+	external := grant.RedirectURI != ""
+	if external {
+		now := time.Now()
+		grant.refreshFamily.init(now)
+		marked, err := markAuthCodeRedeemed(code, redeemedAuthCodeGrant{
+			FamilyID:   grant.FamilyID,
+			ClientID:   grant.ClientID,
+			RedeemedAt: now,
+		})
+		if err != nil {
+			log.Println("NewAuthCodeToken: " + err.Error())
+			return nil, nil, err
+		} else if !marked {
+			err = detectAuthCodeReplay(code)
+			if err == nil {
+				err = fmt.Errorf("recycled/expired/invalid authorization grant")
+			}
+
+			return nil, nil, err
+		}
 	}
 
-	// If not expired, remove it from the Redis cache since
-	// we're about to issue a token for it.
-	go removeAuthCodeGrant(code, redirectURI)
+	// If not expired, remove it from the cache since we're about to issue a token for it.
+	consumed, err := store.CompareAndDelete(authCodeGrantSet, code, grantBytes)
+	if err != nil {
+		log.Println("NewAuthCodeToken: " + err.Error())
+		return nil, nil, err
+	} else if !consumed {
+		return nil, nil, fmt.Errorf("recycled/expired/invalid authorization grant")
+	}
 
 	var token *AuthCodeToken
 	var meta *authCodeTokenMeta
+	var internal internalAuthCodeToken
+	stored := false
 
 	// Generates a new key if a duplicate is encountered
-	for reply == 1 {
+	for !stored {
 		token, meta = generateAuthCodeToken(code)
+		token.ExpiresIn = grant.Lifetimes.AccessTokenSeconds()
+		token.Scope = grant.Scope
+		meta.ClientID = grant.ClientID
+		meta.Subject = grant.Subject
+		meta.Scope = grant.Scope
+		meta.AuthTime = grant.AuthTime
+		meta.RefreshExpiresIn = grant.Lifetimes.RefreshTokenSeconds()
+		meta.RefreshAbsoluteExpires = grant.Lifetimes.RefreshTokenAbsolute
+		meta.refreshFamily = grant.refreshFamily
+		meta.refreshFamily.init(meta.CreationTime)
 
 		// Replace newly-generated refresh token with function parameter 'refreshToken'
 		// if it is of length 72 since SHA-256 generates a string of length 64 and we
@@ -101,122 +225,349 @@ func NewAuthCodeToken(code, refreshToken, redirectURI string) (*AuthCodeToken, e
 			token.RefreshToken = refreshToken
 		}
 
-		reply, err = redis.Int(conn.Do("HEXISTS", authCodeTokensSet, token.AccessToken))
+		internal = internalAuthCodeToken{Token: *token, Meta: *meta}
+		jsonBytes, err := json.Marshal(internal)
+		if err != nil {
+			panic(err)
+		}
+
+		stored, err = store.SetNX(authCodeTokensSet, token.AccessToken, jsonBytes, internal.retention())
 		if err != nil {
 			log.Println(err)
-			return nil, err
+			return nil, nil, err
+		}
+	}
+
+	err = indexRefreshToken(authCodeTokensSet, token.AccessToken, token.RefreshToken, meta.FamilyID, internal.retention())
+	if err != nil {
+		log.Println(err)
+		return nil, nil, err
+	}
+
+	// A replay may have revoked the family before the token joined it
+	if external {
+		redeemed, err := getRedeemedAuthCode(code)
+		if err != nil {
+			return nil, nil, err
+		} else if redeemed != nil && redeemed.Replayed {
+			err = revokeTokenFamily(authCodeTokensSet, meta.FamilyID)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			return nil, nil, ErrAuthCodeReplayed
 		}
 	}
 
-	jsonBytes, err := json.Marshal(internalAuthCodeToken{Token: *token, Meta: *meta})
+	return token, &grant, nil
+}
+
+// Remembers an authorization grant which is being exchanged for a token, so that a replay can be recognized.
+// Returns false if the grant was already remembered, i.e., if it is being replayed.
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.2
+func markAuthCodeRedeemed(code string, redeemed redeemedAuthCodeGrant) (bool, error) {
+	jsonBytes, err := json.Marshal(redeemed)
 	if err != nil {
 		panic(err)
 	}
 
-	_, err = conn.Do("HSET", authCodeTokensSet, token.AccessToken, string(jsonBytes))
+	return store.SetNX(authCodeRedeemedSet, code, jsonBytes, redeemedGrantLifetime*time.Second)
+}
+
+// Looks up an authorization grant which was exchanged for a token.
+// Returns nil if it was not found or is no longer remembered.
+func getRedeemedAuthCode(code string) (*redeemedAuthCodeGrant, error) {
+	jsonBytes, err := store.Get(authCodeRedeemedSet, code)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
+
+	var redeemed redeemedAuthCodeGrant
+	err = json.Unmarshal(jsonBytes, &redeemed)
 	if err != nil {
 		return nil, err
 	}
 
-	return token, nil
+	if expired(redeemed.RedeemedAt, redeemedGrantLifetime) {
+		return nil, nil
+	}
+
+	return &redeemed, nil
+}
+
+// Checks if an authorization grant has already been exchanged for a token, or is being exchanged.
+// If so, it is marked as replayed, so that a token which is still being issued on it is revoked as well.
+// Every token issued on it, including those issued on its refresh token,
+// is revoked and ErrAuthCodeReplayed is returned. Else, nil is returned.
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.2
+// and RFC 6819 Section 4.4.1.1 (https://tools.ietf.org/html/rfc6819#section-4.4.1.1)
+func detectAuthCodeReplay(code string) error {
+	redeemed, err := getRedeemedAuthCode(code)
+	if err != nil || redeemed == nil {
+		return err
+	}
+
+	if !redeemed.Replayed {
+		redeemed.Replayed = true
+		jsonBytes, err := json.Marshal(redeemed)
+		if err != nil {
+			panic(err)
+		}
+
+		err = store.Set(authCodeRedeemedSet, code, jsonBytes, time.Until(redeemed.RedeemedAt.Add(redeemedGrantLifetime*time.Second)))
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Authorization grant issued to %s replayed, revoking its tokens\n", redeemed.ClientID)
+	err = revokeTokenFamily(authCodeTokensSet, redeemed.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	return ErrAuthCodeReplayed
 }
 
 // NewAuthCodeRefreshToken returns new token for the previously issued refresh token
-// The refresh token is kept intact and can be used for future requests.
-func NewAuthCodeRefreshToken(refreshToken string) (*AuthCodeToken, error) {
-	code := NewAuthCodeGrant("")
-	token, err := NewAuthCodeToken(code, refreshToken, "")
+// The previously issued access token is invalidated.
+// If 'rotate' is false, the refresh token is kept intact and can be used for future requests.
+// Else, a new refresh token is issued and the previous one must not be used again.
+// The new token may be issued with a narrower 'scope' than was granted, which defaults to the granted scope.
+// Returns ErrInvalidRefreshToken if the refresh token is not found or was issued to another client,
+// ErrRefreshTokenReused if it was replaced by rotation and ErrInvalidScope if the scope exceeds the granted scope.
+// Refer: https://tools.ietf.org/html/rfc6749#section-6
+func NewAuthCodeRefreshToken(refreshToken, clientID, scope string, rotate bool) (*AuthCodeToken, error) {
+	prev, err := findAuthCodeRefreshToken(refreshToken)
 	if err != nil {
 		return nil, err
+	} else if prev == nil {
+		return nil, detectRefreshTokenReuse(authCodeTokensSet, refreshToken, clientID)
+	} else if prev.Meta.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	family := prev.Meta.refreshFamily
+	family.RefreshScope = prev.refreshScope()
+	scope, err = narrowScope(family.RefreshScope, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	consumed, err := consumeRefreshToken(authCodeTokensSet, refreshToken, prev.Token.AccessToken)
+	if err != nil {
+		return nil, err
+	} else if !consumed {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	invalidateAuthCodeToken(prev.Token.AccessToken)
+
+	code, err := NewAuthCodeGrant(AuthCodeGrant{
+		ClientID:      prev.Meta.ClientID,
+		Scope:         scope,
+		Subject:       prev.Meta.Subject,
+		AuthTime:      prev.Meta.AuthTime,
+		Lifetimes:     prev.lifetimes(),
+		refreshFamily: family,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A new refresh token is generated unless the previous one is passed on
+	nextRefreshToken := refreshToken
+	if rotate {
+		nextRefreshToken = ""
+	}
+
+	token, _, err := NewAuthCodeToken(code, nextRefreshToken, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	if rotate {
+		err = markRefreshTokenRotated(refreshToken, rotatedRefreshToken{
+			FamilyID:  family.FamilyID,
+			ClientID:  clientID,
+			ExpiresAt: prev.refreshExpiry(),
+		})
+		if err != nil {
+			log.Println(err)
+		}
 	}
 
 	return token, nil
 }
 
-// NewAuthCodeGrant generates a new authorization grant and adds it to a Redis cache set.
-// This function takes the redirect URI as an argument, since RFC 6749 requires the same URI
+// NewAuthCodeGrant generates a new authorization grant and adds it to a cache set.
+// The redirect URI is stored along with the authorization grant, since RFC 6749 requires the same URI
 // to be used in the token request as was used in the authorization grant request, if any.
-// Thus, we store it along with the authorization grant in order for us to verify it against
-// the one sent in the token request.
+// Thus, we can verify it against the one sent in the token request, as well as the PKCE code challenge.
+// The user authorizes the request as the grant is issued, unless the grant is issued for a refresh request.
 // Refer: https://tools.ietf.org/html/rfc6749#section-4.1.3
-func NewAuthCodeGrant(redirectURI string) string {
+func NewAuthCodeGrant(grant AuthCodeGrant) (string, error) {
 	var code string
-	var reply = 0
-	var err error
+	var stored = false
+
+	grant.CreationTime = time.Now()
+	if grant.AuthTime.IsZero() {
+		grant.AuthTime = grant.CreationTime
+	}
+
+	jsonBytes, err := json.Marshal(grant)
+	if err != nil {
+		panic(err)
+	}
 
 	// In case we get a duplicate value, we iterate until we get a unique one.
-	conn := NewConn()
-	defer CloseConn(conn)
-	for reply == 0 {
+	for !stored {
 		code = generateNonce(20)
-		value := code + ":" + redirectURI
-		reply, err = redis.Int(conn.Do("HSET", authCodeGrantSet, value, time.Now().Unix()))
-
+		stored, err = store.SetNX(authCodeGrantSet, code, jsonBytes, authCodeGrantLifetime)
 		if err != nil {
-			log.Println(err)
+			return "", err
 		}
 	}
 
-	return code
+	return code, nil
 }
 
-// AuthCodeRefreshTokenExists checks if the refresh token exists in the Redis cache
+// AuthCodeRefreshTokenExists checks if the refresh token exists in the cache
 // and returns the appropriate boolean value.
 // Params:
 // refreshToken: the token to look for in the cache
 // invalidateIfFound: if true, the token is invalidated if found
 func AuthCodeRefreshTokenExists(refreshToken string, invalidateIfFound bool) bool {
-	conn := NewConn()
-	defer CloseConn(conn)
-
-	var token internalAuthCodeToken
-	items, err := redis.ByteSlices(conn.Do("HGETALL", authCodeTokensSet))
+	token, err := findAuthCodeRefreshToken(refreshToken)
 	if err != nil {
 		log.Println(err)
 	}
 
-	for i := 1; i < len(items); i += 2 {
-		err := json.Unmarshal(items[i], &token)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-
-		if refreshToken == token.Token.RefreshToken {
-			if invalidateIfFound {
-				invalidateAuthCodeToken(token.Token.AccessToken)
-			}
+	if token == nil {
+		return false
+	}
 
-			return true
-		}
+	if invalidateIfFound {
+		invalidateAuthCodeToken(token.Token.AccessToken)
 	}
 
-	return false
+	return true
 }
 
-// VerifyAuthCodeToken checks if the token exists in the Redis cache.
+// VerifyAuthCodeToken checks if the token exists in the cache.
 // Returns true if token found, false otherwise.
 func VerifyAuthCodeToken(token string) bool {
-	conn := NewConn()
-	defer CloseConn(conn)
+	jsonBytes, err := store.Get(authCodeTokensSet, token)
+	return err == nil && jsonBytes != nil
+}
+
+// Looks up an access token in the cache.
+// Returns nil if the token was not found.
+func getAuthCodeToken(accessToken string) (*internalAuthCodeToken, error) {
+	jsonBytes, err := store.Get(authCodeTokensSet, accessToken)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
+
+	var token internalAuthCodeToken
+	err = json.Unmarshal(jsonBytes, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Looks up the token which holds the refresh token through the refresh token index.
+// Returns nil if the refresh token was not found.
+func findAuthCodeRefreshToken(refreshToken string) (*internalAuthCodeToken, error) {
+	accessToken, err := lookupRefreshToken(authCodeTokensSet, refreshToken)
+	if err != nil || accessToken == "" {
+		return nil, err
+	}
+
+	token, err := getAuthCodeToken(accessToken)
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	if refreshToken != token.Token.RefreshToken || time.Now().After(token.refreshExpiry()) {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+// Invalidates the access token issued to the client along with the refresh token.
+// Returns true if the refresh token was found.
+func revokeAuthCodeRefreshToken(refreshToken, clientID string) (bool, error) {
+	token, err := findAuthCodeRefreshToken(refreshToken)
+	if err != nil || token == nil || token.Meta.ClientID != clientID {
+		return false, err
+	}
+
+	return store.Delete(authCodeTokensSet, token.Token.AccessToken)
+}
+
+// Describes the token as per RFC 7662.
+func (t *internalAuthCodeToken) info(refresh bool) *TokenInfo {
+	info := &TokenInfo{
+		Active:   true,
+		Scope:    t.Meta.Scope,
+		ClientID: t.Meta.ClientID,
+		Iat:      t.Meta.CreationTime.Unix(),
+		Subject:  t.Meta.Subject,
+		Flow:     "authorization_code",
+	}
+
+	if refresh {
+		info.Exp = t.refreshExpiry().Unix()
+	} else {
+		info.TokenType = "bearer"
+		info.Exp = t.Meta.CreationTime.Add(time.Duration(t.Token.ExpiresIn) * time.Second).Unix()
+	}
+
+	return info
+}
+
+// Returns the lifetimes the token was issued with.
+// Tokens issued without a refresh token lifetime share it with the access token.
+func (t *internalAuthCodeToken) lifetimes() config.TokenLifetimes {
+	return config.TokenLifetimes{
+		AccessToken:          t.Token.ExpiresIn,
+		RefreshToken:         t.Meta.RefreshExpiresIn,
+		RefreshTokenAbsolute: t.Meta.RefreshAbsoluteExpires,
+	}
+}
+
+// Returns the time at which the refresh token expires
+func (t *internalAuthCodeToken) refreshExpiry() time.Time {
+	return t.Meta.refreshExpiry(t.Meta.CreationTime, t.lifetimes())
+}
+
+// Returns the time for which the token is retained, i.e., for as long as its refresh token is valid
+func (t *internalAuthCodeToken) retention() time.Duration {
+	return retention(t.Meta.CreationTime, t.Token.ExpiresIn, t.refreshExpiry())
+}
 
-	_, err := redis.String(conn.Do("HGET", authCodeTokensSet, token))
-	return err == nil
+// Returns the scope granted to the refresh token, which the access token may have narrowed
+func (t *internalAuthCodeToken) refreshScope() string {
+	if t.Meta.RefreshScope != "" {
+		return t.Meta.RefreshScope
+	}
+
+	return t.Meta.Scope
 }
 
-func removeAuthCodeGrant(code, redirectURI string) {
-	conn := NewConn()
-	defer CloseConn(conn)
-	_, err := conn.Do("HDEL", authCodeGrantSet, code+":"+redirectURI)
+func removeAuthCodeGrant(code string) {
+	_, err := store.Delete(authCodeGrantSet, code)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
 func invalidateAuthCodeToken(accessToken string) {
-	conn := NewConn()
-	defer CloseConn(conn)
-	_, err := conn.Do("HDEL", authCodeTokensSet, accessToken)
+	_, err := store.Delete(authCodeTokensSet, accessToken)
 	if err != nil {
 		log.Println(err)
 	}
@@ -235,65 +586,13 @@ func generateAuthCodeToken(code string) (*AuthCodeToken, *authCodeTokenMeta) {
 	refreshToken := AuthCodeFlowID + hash(fmt.Sprintf("%s%s", creationTime, nonce))
 
 	return &AuthCodeToken{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-			ExpiresIn:    3600,
-		}, &authCodeTokenMeta{
-			AuthGrant:    code,
-			CreationTime: creationTime,
-			Nonce:        nonce,
-		}
-}
-
-// Housekeeping service for the Auth Code tokens set
-func authCodeTokenHousekeep(conn redis.Conn) {
-	var token internalAuthCodeToken
-	var err error
-	var diff time.Duration
-
-	items, err := redis.ByteSlices(conn.Do("HGETALL", authCodeTokensSet))
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	for i := 1; i < len(items); i += 2 {
-		err = json.Unmarshal(items[i], &token)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-
-		diff = time.Now().Sub(token.Meta.CreationTime)
-		if diff >= time.Hour {
-			_, err := conn.Do("HDEL", authCodeTokensSet, items[i-1])
-			if err != nil {
-				log.Println(err)
-			}
-		}
-	}
-}
-
-// Housekeeping service for the Auth Code tokens set
-func authCodeGrantHousekeep(conn redis.Conn) {
-	var intTime int64
-	var issueTime time.Time
-
-	grants, err := redis.Strings(conn.Do("HGETALL", authCodeGrantSet))
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	for i := 1; i < len(grants); i += 2 {
-		intTime, _ = strconv.ParseInt(grants[i], 10, 64)
-		issueTime = time.Unix(intTime, 0)
-
-		if time.Now().Sub(issueTime) >= time.Minute*10 {
-			_, err = conn.Do("HDEL", authCodeGrantSet, grants[i-1])
-			if err != nil {
-				log.Println(err)
-			}
-		}
+		AccessToken:  accessToken,
+		TokenType:    "bearer",
+		RefreshToken: refreshToken,
+		ExpiresIn:    3600,
+	}, &authCodeTokenMeta{
+		AuthGrant:    code,
+		CreationTime: creationTime,
+		Nonce:        nonce,
 	}
 }
@@ -2,6 +2,9 @@ package cache
 
 import (
 	"testing"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 // TestAuthCodeFlow tests the entirety of the functions set of authCodeStore
@@ -9,12 +12,16 @@ import (
 func TestAuthCodeFlow(t *testing.T) {
 	// Generating an authorization grant which would
 	// be generated after the user authorizes the client app.
-	code := NewAuthCodeGrant("https://oauth2bin.org")
+	code, err := NewAuthCodeGrant(AuthCodeGrant{RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	t.Logf("Generated authorization code grant: %s\n", code)
 
 	// Generating a token based on the grant which would
 	// be generated by invoking the token endpoint
-	token, err := NewAuthCodeToken(code, "", "https://oauth2bin.org")
+	token, _, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "")
 	if err != nil {
 		t.Fatalf("Could not generate token:\n%s\n", err)
 	}
@@ -28,7 +35,7 @@ func TestAuthCodeFlow(t *testing.T) {
 	}
 
 	// Issue new token based on the previously issued refresh token
-	token, err = NewAuthCodeRefreshToken(token.RefreshToken)
+	token, err = NewAuthCodeRefreshToken(token.RefreshToken, "", "", false)
 	if err != nil {
 		t.Fatalf("Could not generate token from refresh token\n")
 	}
@@ -39,8 +46,12 @@ func TestAuthCodeFlow(t *testing.T) {
 }
 
 func TestRefreshTokenExists(t *testing.T) {
-	code := NewAuthCodeGrant("https://oauth2bin.org")
-	token, err := NewAuthCodeToken(code, "", "https://oauth2bin.org")
+	code, err := NewAuthCodeGrant(AuthCodeGrant{RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -50,7 +61,300 @@ func TestRefreshTokenExists(t *testing.T) {
 	if exists {
 		t.Log("found refresh token")
 	} else {
-		removeAuthCodeGrant(code, "https://oauth2bin.org")
+		removeAuthCodeGrant(code)
 		t.Fatal("failed to find refresh token")
 	}
 }
+
+// TestAuthCodeRedirectURI checks that the redirect URI is only required in the token request
+// if the client sent it in the authorization request, and must match whenever it is sent.
+func TestAuthCodeRedirectURI(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, redirectURI := range []string{"", "https://oauth2bin.org/other"} {
+		_, _, err = NewAuthCodeToken(code, "", redirectURI, "", "")
+		if err == nil {
+			t.Fatalf("Token issued with redirect_uri %q", redirectURI)
+		}
+	}
+
+	defaulted, err := NewAuthCodeGrant(AuthCodeGrant{RedirectURI: "https://oauth2bin.org", RedirectURIDefaulted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = NewAuthCodeToken(defaulted, "", "https://oauth2bin.org/other", "", "")
+	if err == nil {
+		t.Fatal("Token issued with a mismatching redirect_uri")
+	}
+
+	token, _, err := NewAuthCodeToken(defaulted, "", "", "", "")
+	if err != nil {
+		t.Fatalf("Token not issued without the omitted redirect_uri: %v", err)
+	}
+
+	invalidateAuthCodeToken(token.AccessToken)
+	removeAuthCodeGrant(code)
+}
+
+// TestAuthCodePKCE checks that a grant issued with a code challenge
+// can only be exchanged with the matching code verifier.
+func TestAuthCodePKCE(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{
+		RedirectURI:         "https://oauth2bin.org",
+		CodeChallenge:       testChallenge,
+		CodeChallengeMethod: PKCEMethodS256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "")
+	if err == nil {
+		t.Fatal("Token issued without a code verifier")
+	}
+
+	_, _, err = NewAuthCodeToken(code, "", "https://oauth2bin.org", testVerifier[1:]+"A", "")
+	if err == nil {
+		t.Fatal("Token issued for a wrong code verifier")
+	}
+
+	token, _, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", testVerifier, "")
+	if err != nil {
+		t.Fatalf("Could not generate token with the right code verifier:\n%s\n", err)
+	}
+
+	invalidateAuthCodeToken(token.AccessToken)
+}
+
+// TestAuthCodeGrantRoundTrip checks that the OpenID Connect parameters
+// stored with the grant are returned when it is exchanged for a token
+func TestAuthCodeGrantRoundTrip(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{
+		ClientID: "clientID",
+		Scope:    "openid profile",
+		Nonce:    "n-0S6_WzA2Mj",
+		Subject:  "oa2buser",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, grant, err := NewAuthCodeToken(code, "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if grant.Nonce != "n-0S6_WzA2Mj" || grant.Subject != "oa2buser" || token.Scope != "openid profile" {
+		t.Fatalf("Grant parameters lost: %+v", grant)
+	}
+
+	invalidateAuthCodeToken(token.AccessToken)
+}
+
+// TestAuthCodeClientBinding checks that a grant can only be exchanged by the client it was issued to.
+func TestAuthCodeClientBinding(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientA", RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientB")
+	if err == nil {
+		t.Fatal("grant exchanged by another client")
+	}
+
+	token, _, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalidateAuthCodeToken(token.AccessToken)
+}
+
+// TestAuthCodeReplay checks that replaying a grant revokes the tokens issued on it,
+// including those issued on its refresh token.
+func TestAuthCodeReplay(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientA", RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, err := NewAuthCodeRefreshToken(token.RefreshToken, "clientA", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientA")
+	if err != ErrAuthCodeReplayed {
+		t.Fatalf("Expected ErrAuthCodeReplayed, got: %v", err)
+	}
+
+	if VerifyAuthCodeToken(refreshed.AccessToken) {
+		t.Fatal("Token issued on the refresh token survived the replay")
+	}
+
+	if AuthCodeRefreshTokenExists(refreshed.RefreshToken, false) {
+		t.Fatal("Refresh token survived the replay")
+	}
+
+	// Grants which were never redeemed are merely unknown
+	_, _, err = NewAuthCodeToken("unknown", "", "https://oauth2bin.org", "", "clientA")
+	if err == nil || err == ErrAuthCodeReplayed {
+		t.Fatalf("Expected an invalid grant error, got: %v", err)
+	}
+}
+
+// TestAuthCodeReplayDuringRedemption checks that a grant replayed while it is being exchanged
+// is recognized as a replay and flagged, so that the token being issued on it is revoked
+func TestAuthCodeReplayDuringRedemption(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientA", RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeAuthCodeGrant(code)
+
+	// Another request has marked the grant as redeemed, but not removed it yet
+	marked, err := markAuthCodeRedeemed(code, redeemedAuthCodeGrant{FamilyID: "family", ClientID: "clientA", RedeemedAt: time.Now()})
+	if err != nil || !marked {
+		t.Fatalf("Grant not marked as redeemed: %v", err)
+	}
+
+	_, _, err = NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientA")
+	if err != ErrAuthCodeReplayed {
+		t.Fatalf("Expected ErrAuthCodeReplayed, got: %v", err)
+	}
+
+	redeemed, err := getRedeemedAuthCode(code)
+	if err != nil || redeemed == nil || !redeemed.Replayed {
+		t.Fatalf("Replay not flagged: %+v, %v", redeemed, err)
+	}
+}
+
+// A store which serves the records of a memory store, but cannot store new ones
+type readOnlyStore struct {
+	*memoryStore
+}
+
+func (s readOnlyStore) Set(set, key string, value []byte, ttl time.Duration) error {
+	return errStoreDown
+}
+
+func (s readOnlyStore) SetNX(set, key string, value []byte, ttl time.Duration) (bool, error) {
+	return false, errStoreDown
+}
+
+// TestAuthCodeStoreFailure checks that grants and refreshed tokens which cannot be stored fail
+// instead of being retried forever
+func TestAuthCodeStoreFailure(t *testing.T) {
+	memory := newMemoryStore()
+	previous := store
+	store = memory
+	defer func() { store = previous }()
+
+	code, err := NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _, err := NewAuthCodeToken(code, "", "", "", "clientID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = readOnlyStore{memory}
+
+	_, err = NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientID"})
+	if err != errStoreDown {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = NewAuthCodeRefreshToken(token.RefreshToken, "clientID", "", false)
+	if err != errStoreDown {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// TestAuthCodeAuthTime checks that the time of the authorization is kept by the tokens issued on refresh requests
+func TestAuthCodeAuthTime(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientID", RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, grant, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientID")
+	if err != nil {
+		t.Fatal(err)
+	} else if grant.AuthTime.IsZero() {
+		t.Fatal("Authorization time not recorded")
+	}
+
+	token, err = NewAuthCodeRefreshToken(token.RefreshToken, "clientID", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer invalidateAuthCodeToken(token.AccessToken)
+
+	refreshed, err := getAuthCodeToken(token.AccessToken)
+	if err != nil || refreshed == nil {
+		t.Fatalf("Refreshed token not found: %v", err)
+	}
+
+	if !refreshed.Meta.AuthTime.Equal(grant.AuthTime) {
+		t.Fatalf("Authorization time moved from %s to %s on refresh", grant.AuthTime, refreshed.Meta.AuthTime)
+	}
+}
+
+// BenchmarkAuthCodeRefreshToken measures a refresh request while the cache holds
+// a growing number of live tokens. The refresh token is looked up through
+// its index, hence the cost must not grow with the number of live tokens.
+func BenchmarkAuthCodeRefreshToken(b *testing.B) {
+	issue := func() (*AuthCodeToken, error) {
+		code, err := NewAuthCodeGrant(AuthCodeGrant{
+			ClientID:    "clientID",
+			RedirectURI: "https://oauth2bin.org",
+			Lifetimes:   config.TokenLifetimes{AccessToken: 60},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		token, _, err := NewAuthCodeToken(code, "", "https://oauth2bin.org", "", "clientID")
+		return token, err
+	}
+
+	issueAccessToken := func() (string, error) {
+		token, err := issue()
+		if err != nil {
+			return "", err
+		}
+
+		return token.AccessToken, nil
+	}
+
+	benchmarkLiveTokens(b, issueAccessToken, invalidateAuthCodeToken, func(b *testing.B) {
+		token, err := issue()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			token, err = NewAuthCodeRefreshToken(token.RefreshToken, "clientID", "", false)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		invalidateAuthCodeToken(token.AccessToken)
+	})
+}
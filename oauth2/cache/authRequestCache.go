@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// Set which holds the authorization requests awaiting the user's decision
+	authRequestsSet = "OA2B_AuthRequests"
+
+	// Seconds for which the user may take to accept or deny an authorization request
+	AuthRequestLifetime = 600
+)
+
+// AuthRequest holds the parameters of a validated authorization request until the user
+// accepts or denies it on the authorization screen. The flow is completed from these,
+// rather than from the parameters posted by the authorization screen.
+//
+// RedirectURIDefaulted is set if the client omitted the redirect URI and the only one it registered is used.
+// UserCode is set for the Device flow, where the user approves a device authorization.
+type AuthRequest struct {
+	Flow                 int       `json:"flow"`
+	ClientID             string    `json:"client_id,omitempty"`
+	RedirectURI          string    `json:"redirect_uri,omitempty"`
+	RedirectURIDefaulted bool      `json:"redirect_uri_defaulted,omitempty"`
+	ResponseType         string    `json:"response_type,omitempty"`
+	Scope                string    `json:"scope,omitempty"`
+	State                string    `json:"state,omitempty"`
+	Nonce                string    `json:"nonce,omitempty"`
+	CodeChallenge        string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod  string    `json:"code_challenge_method,omitempty"`
+	UserCode             string    `json:"user_code,omitempty"`
+	CreationTime         time.Time `json:"creation_time"`
+}
+
+// Holds the request along with the hash of its CSRF token.
+// It is the internal representation of the request inside the cache.
+type internalAuthRequest struct {
+	AuthRequest
+	CSRFTokenHash string `json:"csrf_token_hash"`
+}
+
+// NewAuthRequest stores the authorization request under a new request ID.
+// Returns the request ID, which is embedded in the authorization screen, and a CSRF token
+// which must be presented along with it by the same user-agent in order to complete the request.
+func NewAuthRequest(request AuthRequest) (string, string, error) {
+	request.CreationTime = time.Now()
+	csrfToken := hash(fmt.Sprintf("%s%s", request.CreationTime, generateNonce(32)))
+
+	jsonBytes, err := json.Marshal(internalAuthRequest{AuthRequest: request, CSRFTokenHash: hash(csrfToken)})
+	if err != nil {
+		panic(err)
+	}
+
+	var requestID string
+	stored := false
+
+	// Generates a new request ID if a duplicate is encountered
+	for !stored {
+		requestID = hash(fmt.Sprintf("%s%s", request.CreationTime, generateNonce(32)))
+		stored, err = store.SetNX(authRequestsSet, requestID, jsonBytes, AuthRequestLifetime*time.Second)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return requestID, csrfToken, nil
+}
+
+// ConsumeAuthRequest looks up an authorization request and removes it, so that it can
+// only be completed once. Returns nil if the request was not found, has expired, or if the
+// CSRF token does not match, in which case the request remains untouched.
+func ConsumeAuthRequest(requestID, csrfToken string) (*AuthRequest, error) {
+	jsonBytes, err := store.Get(authRequestsSet, requestID)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
+
+	var request internalAuthRequest
+	err = json.Unmarshal(jsonBytes, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash(csrfToken)), []byte(request.CSRFTokenHash)) != 1 {
+		return nil, nil
+	}
+
+	_, err = store.Delete(authRequestsSet, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	if expired(request.CreationTime, AuthRequestLifetime) {
+		return nil, nil
+	}
+
+	return &request.AuthRequest, nil
+}
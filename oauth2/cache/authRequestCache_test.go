@@ -0,0 +1,36 @@
+package cache
+
+import "testing"
+
+// TestAuthRequest checks that an authorization request can only be completed
+// once, and only with the CSRF token it was issued with.
+func TestAuthRequest(t *testing.T) {
+	requestID, csrfToken, err := NewAuthRequest(AuthRequest{
+		Flow:        1,
+		ClientID:    "clientID",
+		RedirectURI: "https://oauth2bin.org",
+		State:       "xyz",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := ConsumeAuthRequest(requestID, "forged")
+	if err != nil || request != nil {
+		t.Fatalf("Request consumed with a forged CSRF token: %+v, %v", request, err)
+	}
+
+	request, err = ConsumeAuthRequest(requestID, csrfToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request == nil || request.ClientID != "clientID" || request.State != "xyz" {
+		t.Fatalf("Unexpected request: %+v", request)
+	}
+
+	request, err = ConsumeAuthRequest(requestID, csrfToken)
+	if err != nil || request != nil {
+		t.Fatalf("Request consumed twice: %+v, %v", request, err)
+	}
+}
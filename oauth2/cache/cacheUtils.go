@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"math/rand"
 	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 // Hashes the string using SHA-256
@@ -14,6 +16,35 @@ func hash(str string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
+// Checks if something created at 'creationTime' has outlived its lifetime in seconds
+func expired(creationTime time.Time, lifetime int) bool {
+	return time.Now().Sub(creationTime) >= time.Duration(lifetime)*time.Second
+}
+
+// Returns the time for which a token created at 'creationTime' is retained. It is retained until
+// the access token has outlived its lifetime in seconds and the refresh token has expired.
+func retention(creationTime time.Time, lifetime int, refreshExpiry time.Time) time.Duration {
+	ttl := time.Until(creationTime.Add(time.Duration(lifetime) * time.Second))
+	if refreshTTL := time.Until(refreshExpiry); refreshTTL > ttl {
+		return refreshTTL
+	}
+
+	return ttl
+}
+
+// Determines the scope of a token issued on a refresh token granted 'granted'.
+// The scope may be narrowed but not widened. It defaults to the granted scope if not requested.
+// Refer: https://tools.ietf.org/html/rfc6749#section-6
+func narrowScope(granted, requested string) (string, error) {
+	if requested == "" {
+		return granted, nil
+	} else if !config.ScopeIncludes(granted, requested) {
+		return "", ErrInvalidScope
+	}
+
+	return requested, nil
+}
+
 const src = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
 
 // Generates a string of given length filled with random bytes
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// Set which holds the clients created at the registration endpoint
+const clientsSet = "OA2B_Clients"
+
+// RegisteredClient represents a client created at the registration endpoint
+// Refer: https://tools.ietf.org/html/rfc7591#section-3.2.1
+type RegisteredClient struct {
+	config.Client
+	IssuedAt time.Time `json:"issued_at"`
+}
+
+// Holds the client along with the hash of its registration access token.
+// It is the internal representation of the client inside the cache.
+type internalClient struct {
+	RegisteredClient
+	RegistrationTokenHash string `json:"registration_token_hash"`
+}
+
+// RegisterClient stores a new client with the given metadata.
+// A client ID is generated, along with a secret unless the client is public.
+// Returns the client and the registration access token for managing it.
+func RegisterClient(client config.Client) (*RegisteredClient, string, error) {
+	now := time.Now()
+	registrationToken := hash(fmt.Sprintf("%s%s", now, generateNonce(32)))
+
+	stored := internalClient{
+		RegisteredClient: RegisteredClient{
+			Client:   client,
+			IssuedAt: now,
+		},
+		RegistrationTokenHash: hash(registrationToken),
+	}
+
+	stored.ClientSecret = ""
+	if !client.IsPublic() {
+		stored.ClientSecret = hash(fmt.Sprintf("%s%s", now, generateNonce(32)))
+	}
+
+	created := false
+
+	// Generates a new client ID if a duplicate is encountered
+	for !created {
+		stored.ClientID = hash(fmt.Sprintf("%s%s", now, generateNonce(16)))[:32]
+
+		jsonBytes, err := json.Marshal(stored)
+		if err != nil {
+			panic(err)
+		}
+
+		created, err = store.SetNX(clientsSet, stored.ClientID, jsonBytes, NoExpiry)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &stored.RegisteredClient, registrationToken, nil
+}
+
+// GetClient looks up a client created at the registration endpoint.
+// Returns nil if the client was not found.
+func GetClient(clientID string) (*RegisteredClient, error) {
+	client, err := getClient(clientID)
+	if client == nil || err != nil {
+		return nil, err
+	}
+
+	return &client.RegisteredClient, nil
+}
+
+// AuthorizeClientManagement checks the registration access token presented for
+// reading, updating or deleting a client. Returns nil if the client was not found
+// or the token does not belong to it.
+// Refer: https://tools.ietf.org/html/rfc7592#section-3
+func AuthorizeClientManagement(clientID, registrationToken string) (*RegisteredClient, error) {
+	client, err := getClient(clientID)
+	if client == nil || err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash(registrationToken)), []byte(client.RegistrationTokenHash)) != 1 {
+		return nil, nil
+	}
+
+	return &client.RegisteredClient, nil
+}
+
+// UpdateClient replaces the metadata of a client. The client ID, secret and
+// registration access token remain unchanged, while the authentication method decides
+// whether the client keeps its secret. Returns nil if the client was not found.
+// Refer: https://tools.ietf.org/html/rfc7592#section-2.2
+func UpdateClient(clientID string, metadata config.Client) (*RegisteredClient, error) {
+	client, err := getClient(clientID)
+	if client == nil || err != nil {
+		return nil, err
+	}
+
+	secret := client.ClientSecret
+	client.Client = metadata
+	client.ClientID = clientID
+	client.ClientSecret = ""
+
+	if !metadata.IsPublic() {
+		client.ClientSecret = secret
+		if secret == "" {
+			client.ClientSecret = hash(fmt.Sprintf("%s%s", time.Now(), generateNonce(32)))
+		}
+	}
+
+	jsonBytes, err := json.Marshal(client)
+	if err != nil {
+		panic(err)
+	}
+
+	err = store.Set(clientsSet, clientID, jsonBytes, NoExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client.RegisteredClient, nil
+}
+
+// DeleteClient removes a client created at the registration endpoint, after revoking the tokens issued to it.
+// Returns ErrStoreDegraded while the store is degraded, in which case the client is kept.
+// Refer: https://tools.ietf.org/html/rfc7592#section-2.3
+func DeleteClient(clientID string) error {
+	err := revokeClientTokens(clientID)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Delete(clientsSet, clientID)
+	return err
+}
+
+// Looks up a client in the cache.
+// Returns nil if the client was not found.
+func getClient(clientID string) (*internalClient, error) {
+	jsonBytes, err := store.Get(clientsSet, clientID)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
+
+	var client internalClient
+	err = json.Unmarshal(jsonBytes, &client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
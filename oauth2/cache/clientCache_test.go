@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestClientRegistration tests the lifecycle of a client created at the registration endpoint
+func TestClientRegistration(t *testing.T) {
+	client, registrationToken, err := RegisterClient(config.Client{
+		ClientName:              "Test Client",
+		RedirectURIs:            []string{"https://client.example.org/callback"},
+		GrantTypes:              []string{"authorization_code"},
+		TokenEndpointAuthMethod: config.AuthMethodSecretBasic,
+	})
+	if err != nil {
+		t.Fatalf("Could not register client:\n%s\n", err)
+	}
+
+	if client.ClientID == "" || client.ClientSecret == "" || registrationToken == "" {
+		t.Fatalf("Credentials not generated: %+v", client)
+	}
+
+	found, err := GetClient(client.ClientID)
+	if err != nil || found == nil || found.ClientSecret != client.ClientSecret || found.ClientName != "Test Client" {
+		t.Fatalf("Client not found: %+v, %v", found, err)
+	}
+
+	if found, _ = AuthorizeClientManagement(client.ClientID, registrationToken+"0"); found != nil {
+		t.Fatal("Invalid registration access token accepted")
+	}
+
+	if found, _ = AuthorizeClientManagement(client.ClientID, registrationToken); found == nil {
+		t.Fatal("Registration access token rejected")
+	}
+
+	// Public clients do not keep a secret
+	updated, err := UpdateClient(client.ClientID, config.Client{
+		ClientID:                "anotherClientID",
+		RedirectURIs:            []string{"https://client.example.org/callback"},
+		GrantTypes:              []string{"implicit"},
+		TokenEndpointAuthMethod: config.AuthMethodNone,
+	})
+	if err != nil || updated.ClientID != client.ClientID || updated.ClientSecret != "" || !updated.AllowsGrantType("implicit") {
+		t.Fatalf("Unexpected client after update: %+v, %v", updated, err)
+	}
+
+	err = DeleteClient(client.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found, _ = GetClient(client.ClientID); found != nil {
+		t.Fatal("Deleted client still exists")
+	}
+
+	if updated, _ = UpdateClient(client.ClientID, config.Client{}); updated != nil {
+		t.Fatal("Deleted client updated")
+	}
+}
+
+// TestDeleteClientRevokesTokens checks that the tokens issued to a deleted client are revoked,
+// while those of other clients are kept
+func TestDeleteClientRevokesTokens(t *testing.T) {
+	client, _, err := RegisterClient(config.Client{GrantTypes: []string{"client_credentials", "password"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ccToken, err := NewClientCredsToken(client.ClientID, "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ropcToken, err := NewROPCToken(client.ClientID, "oa2buser", "", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewClientCredsToken("otherClientID", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer invalidateClientCredsToken(other.AccessToken)
+
+	err = DeleteClient(client.ClientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if VerifyClientCredsToken(ccToken.AccessToken) || VerifyROPCToken(ropcToken.AccessToken) ||
+		ROPCRefreshTokenExists(ropcToken.RefreshToken, false) {
+		t.Fatal("Token of the deleted client still valid")
+	}
+
+	if !VerifyClientCredsToken(other.AccessToken) {
+		t.Fatal("Token of another client revoked")
+	}
+}
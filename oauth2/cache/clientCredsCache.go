@@ -6,32 +6,36 @@ import (
 	"log"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 const (
-	// Redis HSET which holds the issued tokens
+	// Set which holds the issued tokens
 	clientCredsTokensSet = "OA2B_CC_Tokens"
 
 	// ClientCredsFlowID is prepended to access and refresh tokens issued by the Client Credentials flow
 	ClientCredsFlowID = "CLICREDS"
 )
 
-// ClientCredentialsToken represents a token issued by the Resource Owner Password Credentials flow
-// https://tools.ietf.org/html/rfc6749#section-4.3.3
+// ClientCredentialsToken represents a token issued by the Client Credentials flow
+// https://tools.ietf.org/html/rfc6749#section-4.4.3
 type ClientCredentialsToken struct {
 	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
 	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
 }
 
 // Holds the meta data of an access token
 type clientCredsTokenMeta struct {
+	ClientID     string    `json:"client_id"`
+	Scope        string    `json:"scope,omitempty"`
 	CreationTime time.Time `json:"creation_time"`
 	Nonce        string    `json:"nonce"`
 }
 
 // Holds the token as well as its metadata.
-// It is the internal representation of the token inside the Redis cache.
+// It is the internal representation of the token inside the cache.
 type internalClientCredsToken struct {
 	Token ClientCredentialsToken `json:"token"`
 	Meta  clientCredsTokenMeta   `json:"meta"`
@@ -39,54 +43,74 @@ type internalClientCredsToken struct {
 
 // NewClientCredsToken issues new access tokens for the Client Credentials flow.
 // It generates and stores a token and stores it along with its meta data
-// in the Redis cache.
-func NewClientCredsToken() (*ClientCredentialsToken, error) {
-	conn := NewConn()
-	defer CloseConn(conn)
-
+// in the cache. The token expires as per the lifetimes of the client.
+func NewClientCredsToken(clientID, scope string, lifetimes config.TokenLifetimes) (*ClientCredentialsToken, error) {
 	var token *ClientCredentialsToken
 	var meta *clientCredsTokenMeta
-	var err error
-	reply := 1
+	stored := false
 
 	// Generates a new key if a duplicate is encountered
-	for reply == 1 {
+	for !stored {
 		token, meta = generateClientCredsToken()
+		token.ExpiresIn = lifetimes.AccessTokenSeconds()
+		token.Scope = scope
+		meta.ClientID = clientID
+		meta.Scope = scope
 
-		reply, err = redis.Int(conn.Do("HEXISTS", clientCredsTokensSet, token.AccessToken))
+		jsonBytes, err := json.Marshal(internalClientCredsToken{Token: *token, Meta: *meta})
+		if err != nil {
+			panic(err)
+		}
+
+		stored, err = store.SetNX(clientCredsTokensSet, token.AccessToken, jsonBytes, time.Duration(token.ExpiresIn)*time.Second)
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
 	}
 
-	jsonBytes, err := json.Marshal(internalClientCredsToken{Token: *token, Meta: *meta})
-	if err != nil {
-		panic(err)
+	return token, nil
+}
+
+// VerifyClientCredsToken checks if the token exists in the cache.
+// Returns true if token found, false otherwise.
+func VerifyClientCredsToken(token string) bool {
+	jsonBytes, err := store.Get(clientCredsTokensSet, token)
+	return err == nil && jsonBytes != nil
+}
+
+// Looks up an access token in the cache.
+// Returns nil if the token was not found.
+func getClientCredsToken(accessToken string) (*internalClientCredsToken, error) {
+	jsonBytes, err := store.Get(clientCredsTokensSet, accessToken)
+	if err != nil || jsonBytes == nil {
+		return nil, err
 	}
 
-	_, err = conn.Do("HSET", clientCredsTokensSet, token.AccessToken, string(jsonBytes))
+	var token internalClientCredsToken
+	err = json.Unmarshal(jsonBytes, &token)
 	if err != nil {
 		return nil, err
 	}
 
-	return token, nil
+	return &token, nil
 }
 
-// VerifyClientCredsToken checks if the token exists in the Redis cache.
-// Returns true if token found, false otherwise.
-func VerifyClientCredsToken(token string) bool {
-	conn := NewConn()
-	defer CloseConn(conn)
-
-	_, err := redis.String(conn.Do("HGET", clientCredsTokensSet, token))
-	return err == nil
+// Describes the token as per RFC 7662.
+func (t *internalClientCredsToken) info() *TokenInfo {
+	return &TokenInfo{
+		Active:    true,
+		Scope:     t.Meta.Scope,
+		ClientID:  t.Meta.ClientID,
+		TokenType: "bearer",
+		Exp:       t.Meta.CreationTime.Add(time.Duration(t.Token.ExpiresIn) * time.Second).Unix(),
+		Iat:       t.Meta.CreationTime.Unix(),
+		Flow:      "client_credentials",
+	}
 }
 
 func invalidateClientCredsToken(accessToken string) {
-	conn := NewConn()
-	defer CloseConn(conn)
-	_, err := conn.Do("HDEL", clientCredsTokensSet, accessToken)
+	_, err := store.Delete(clientCredsTokensSet, accessToken)
 	if err != nil {
 		log.Println(err)
 	}
@@ -102,39 +126,11 @@ func generateClientCredsToken() (*ClientCredentialsToken, *clientCredsTokenMeta)
 	accessToken := ClientCredsFlowID + hash(fmt.Sprintf("%s%s", creationTime, nonce))
 
 	return &ClientCredentialsToken{
-			AccessToken: accessToken,
-			ExpiresIn:   3600,
-		}, &clientCredsTokenMeta{
-			CreationTime: creationTime,
-			Nonce:        nonce,
-		}
-}
-
-// Housekeeping service for the Client Credentials tokens set
-func clientCredsTokenHousekeep(conn redis.Conn) {
-	var token internalClientCredsToken
-	var err error
-	var diff time.Duration
-
-	items, err := redis.ByteSlices(conn.Do("HGETALL", clientCredsTokensSet))
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	for i := 1; i < len(items); i += 2 {
-		err = json.Unmarshal(items[i], &token)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-
-		diff = time.Now().Sub(token.Meta.CreationTime)
-		if diff >= time.Hour {
-			_, err = conn.Do("HDEL", clientCredsTokensSet, items[i-1])
-			if err != nil {
-				log.Println(err)
-			}
-		}
+		AccessToken: accessToken,
+		TokenType:   "bearer",
+		ExpiresIn:   3600,
+	}, &clientCredsTokenMeta{
+		CreationTime: creationTime,
+		Nonce:        nonce,
 	}
 }
@@ -1,20 +1,24 @@
 package cache
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
 
 // TestClientCredsFlow tests the entirety of the functions set of authCodeStore
 // as they would be used by the Implicit Grant flow
 func TestClientCredsFlow(t *testing.T) {
 	// Generating a token which would be done once the user authorizes
 	// the client application
-	token, err := NewClientCredsToken()
+	token, err := NewClientCredsToken("clientID", "", config.TokenLifetimes{})
 	if err != nil {
 		t.Fatalf("Could not generate token:\n%s\n", err)
 	}
 
 	t.Logf("Token generated: %s\n", token.AccessToken)
 
-	// Check if token exists in the Redis cache
+	// Check if token exists in the cache
 	res := VerifyClientCredsToken(token.AccessToken)
 	if !res {
 		t.Fatalf("Client Credentials token verification failed\n")
@@ -24,3 +28,33 @@ func TestClientCredsFlow(t *testing.T) {
 	invalidateClientCredsToken(token.AccessToken)
 	t.Logf("Token invalidated\n")
 }
+
+// BenchmarkClientCredsToken measures issuing and verifying a token while the cache holds
+// a growing number of live tokens. Every token is stored under its own key and expired
+// by the store, hence the cost must not grow with the number of live tokens.
+func BenchmarkClientCredsToken(b *testing.B) {
+	lifetimes := config.TokenLifetimes{AccessToken: 60}
+	issue := func() (string, error) {
+		token, err := NewClientCredsToken("clientID", "", lifetimes)
+		if err != nil {
+			return "", err
+		}
+
+		return token.AccessToken, nil
+	}
+
+	benchmarkLiveTokens(b, issue, invalidateClientCredsToken, func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			accessToken, err := issue()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if !VerifyClientCredsToken(accessToken) {
+				b.Fatal("Client Credentials token verification failed")
+			}
+
+			invalidateClientCredsToken(accessToken)
+		}
+	})
+}
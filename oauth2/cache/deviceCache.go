@@ -0,0 +1,432 @@
+package cache
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+const (
+	// Set which holds the pending device authorizations, keyed by device code
+	deviceGrantsSet = "OA2B_DC_Grants"
+
+	// Set which maps user codes to device codes
+	deviceUserCodesSet = "OA2B_DC_UserCodes"
+
+	// Set which holds the issued tokens
+	deviceTokensSet = "OA2B_DC_Tokens"
+
+	// DeviceFlowID is prepended to device codes and access tokens issued by the Device Authorization Grant flow
+	DeviceFlowID = "DEVICECD"
+
+	// Lifetime of the device code in seconds
+	deviceCodeLifetime = 600
+
+	// Minimum interval between polling requests in seconds, and the
+	// increment applied to it on every slow_down error.
+	// Refer: https://tools.ietf.org/html/rfc8628#section-3.5
+	devicePollingInterval = 5
+
+	// Character set of user codes, i.e., the base-20 set of consonants recommended by the RFC
+	// Refer: https://tools.ietf.org/html/rfc8628#section-6.1
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength  = 8
+)
+
+// Errors returned while polling for a token, named after the error codes defined in
+// RFC 8628 Section 3.5 (https://tools.ietf.org/html/rfc8628#section-3.5)
+var (
+	ErrAuthorizationPending = errors.New("the user has not yet completed the authorization")
+	ErrSlowDown             = errors.New("polling too frequently, increase the interval by 5 seconds")
+	ErrAccessDenied         = errors.New("the user denied the authorization request")
+	ErrExpiredToken         = errors.New("the device_code has expired")
+	ErrInvalidDeviceCode    = errors.New("invalid device_code")
+)
+
+// Status of a device authorization
+const (
+	deviceStatusPending  = "pending"
+	deviceStatusApproved = "approved"
+	deviceStatusDenied   = "denied"
+)
+
+// DeviceGrant represents the codes issued by the device authorization endpoint
+// Refer: https://tools.ietf.org/html/rfc8628#section-3.2
+type DeviceGrant struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	ExpiresIn  int
+	Interval   int
+}
+
+// Holds the state of a device authorization.
+// It is the internal representation of the grant inside the cache.
+type internalDeviceGrant struct {
+	ClientID     string    `json:"client_id"`
+	Scope        string    `json:"scope,omitempty"`
+	UserCode     string    `json:"user_code"`
+	Status       string    `json:"status"`
+	Subject      string    `json:"subject,omitempty"`
+	Interval     int       `json:"interval"`
+	LastPolled   time.Time `json:"last_polled"`
+	CreationTime time.Time `json:"creation_time"`
+}
+
+// DeviceToken represents a token issued by the Device Authorization Grant flow
+// https://tools.ietf.org/html/rfc8628#section-3.5
+type DeviceToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// Holds the meta data of an access token
+type deviceTokenMeta struct {
+	ClientID     string    `json:"client_id"`
+	Subject      string    `json:"subject,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	CreationTime time.Time `json:"creation_time"`
+	Nonce        string    `json:"nonce"`
+}
+
+// Holds the token as well as its metadata.
+// It is the internal representation of the token inside the cache.
+type internalDeviceToken struct {
+	Token DeviceToken     `json:"token"`
+	Meta  deviceTokenMeta `json:"meta"`
+}
+
+// NewDeviceGrant issues a device code and a user code for the client.
+// The authorization stays pending until the user approves or denies it.
+func NewDeviceGrant(clientID, scope string) (*DeviceGrant, error) {
+	grant := internalDeviceGrant{
+		ClientID:     clientID,
+		Scope:        scope,
+		Status:       deviceStatusPending,
+		Interval:     devicePollingInterval,
+		CreationTime: time.Now(),
+	}
+
+	var deviceCode string
+	stored := false
+
+	// Generates a new user code if a duplicate is encountered
+	for !stored {
+		var err error
+		deviceCode = DeviceFlowID + hash(fmt.Sprintf("%s%s", grant.CreationTime, generateNonce(16)))
+		grant.UserCode, err = generateUserCode()
+		if err != nil {
+			return nil, err
+		}
+
+		stored, err = store.SetNX(deviceUserCodesSet, grant.UserCode, []byte(deviceCode), deviceCodeLifetime*time.Second)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jsonBytes, err := json.Marshal(grant)
+	if err != nil {
+		panic(err)
+	}
+
+	err = store.Set(deviceGrantsSet, deviceCode, jsonBytes, grant.retention())
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeviceGrant{
+		DeviceCode: deviceCode,
+		UserCode:   FormatUserCode(grant.UserCode),
+		ClientID:   clientID,
+		Scope:      scope,
+		ExpiresIn:  deviceCodeLifetime,
+		Interval:   devicePollingInterval,
+	}, nil
+}
+
+// GetDeviceGrant looks up a pending device authorization by the user code
+// entered by the user. Returns nil if the code is unknown, expired or
+// has already been used.
+func GetDeviceGrant(userCode string) (*DeviceGrant, error) {
+	deviceCode, grant, err := getDeviceGrantByUserCode(userCode)
+	if grant == nil || err != nil || grant.Status != deviceStatusPending {
+		return nil, err
+	}
+
+	return &DeviceGrant{
+		DeviceCode: deviceCode,
+		UserCode:   FormatUserCode(grant.UserCode),
+		ClientID:   grant.ClientID,
+		Scope:      grant.Scope,
+		ExpiresIn:  grant.expiresIn(),
+		Interval:   grant.Interval,
+	}, nil
+}
+
+// ResolveDeviceGrant records the user's decision on the device authorization
+// identified by the user code. Returns false if the code is unknown, expired
+// or has already been used.
+func ResolveDeviceGrant(userCode, subject string, approved bool) (bool, error) {
+	deviceCode, grant, err := getDeviceGrantByUserCode(userCode)
+	if grant == nil || err != nil || grant.Status != deviceStatusPending {
+		return false, err
+	}
+
+	if approved {
+		grant.Status = deviceStatusApproved
+		grant.Subject = subject
+	} else {
+		grant.Status = deviceStatusDenied
+	}
+
+	// The user code is single-use
+	_, err = store.Delete(deviceUserCodesSet, grant.UserCode)
+	if err != nil {
+		return false, err
+	}
+
+	return true, putDeviceGrant(deviceCode, grant)
+}
+
+// NewDeviceToken is invoked when the device polls the token endpoint.
+// It issues an access token once the user has approved the authorization, after
+// which the device code can no longer be used. Until then, one of ErrAuthorizationPending,
+// ErrSlowDown, ErrAccessDenied, ErrExpiredToken or ErrInvalidDeviceCode is returned.
+// The token expires as per the lifetimes of the client.
+// Refer: https://tools.ietf.org/html/rfc8628#section-3.5
+func NewDeviceToken(deviceCode, clientID string, lifetimes config.TokenLifetimes) (*DeviceToken, error) {
+	grant, err := getDeviceGrant(deviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant == nil || grant.ClientID != clientID {
+		return nil, ErrInvalidDeviceCode
+	}
+
+	// Expired grants are kept until twice their lifetime, to report them as expired
+	if grant.expiresIn() <= 0 {
+		return nil, ErrExpiredToken
+	}
+
+	switch grant.Status {
+	case deviceStatusDenied:
+		removeDeviceGrant(deviceCode, grant)
+		return nil, ErrAccessDenied
+	case deviceStatusPending:
+		// The interval is increased for all subsequent requests if the device polls too frequently
+		now := time.Now()
+		tooFast := now.Sub(grant.LastPolled) < time.Duration(grant.Interval)*time.Second
+		if tooFast {
+			grant.Interval += devicePollingInterval
+		}
+
+		grant.LastPolled = now
+		err = putDeviceGrant(deviceCode, grant)
+		if err != nil {
+			return nil, err
+		}
+
+		if tooFast {
+			return nil, ErrSlowDown
+		}
+
+		return nil, ErrAuthorizationPending
+	}
+
+	// Approved: the device code is consumed by issuing the token
+	removeDeviceGrant(deviceCode, grant)
+
+	var token *DeviceToken
+	var meta *deviceTokenMeta
+	stored := false
+
+	// Generates a new key if a duplicate is encountered
+	for !stored {
+		token, meta = generateDeviceToken()
+		token.ExpiresIn = lifetimes.AccessTokenSeconds()
+		token.Scope = grant.Scope
+		meta.ClientID = grant.ClientID
+		meta.Subject = grant.Subject
+		meta.Scope = grant.Scope
+
+		jsonBytes, err := json.Marshal(internalDeviceToken{Token: *token, Meta: *meta})
+		if err != nil {
+			panic(err)
+		}
+
+		stored, err = store.SetNX(deviceTokensSet, token.AccessToken, jsonBytes, time.Duration(token.ExpiresIn)*time.Second)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+// FormatUserCode splits the user code into two halves separated by a dash
+// to make it easier to read and type, for example "WDJB-MJHT".
+func FormatUserCode(userCode string) string {
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// Normalizes the user code entered by the user, since users may
+// enter it in lowercase, or without or with extra separators.
+// Refer: https://tools.ietf.org/html/rfc8628#section-6.1
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(c rune) rune {
+		if c == '-' || c == ' ' {
+			return -1
+		}
+
+		return c
+	}, strings.ToUpper(userCode))
+}
+
+// Generates a user code using a cryptographically secure source
+// since user codes are short enough to be guessed otherwise.
+func generateUserCode() (string, error) {
+	b := make([]byte, userCodeLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range b {
+		b[i] = userCodeCharset[int(b[i])%len(userCodeCharset)]
+	}
+
+	return string(b), nil
+}
+
+// Generates an access token.
+// Access token is a hex-encoded string of the SHA-256 hash of the
+// concatenation of the time of creation and a nonce.
+func generateDeviceToken() (*DeviceToken, *deviceTokenMeta) {
+	nonce := generateNonce(16)
+	creationTime := time.Now()
+
+	accessToken := DeviceFlowID + hash(fmt.Sprintf("%s%s", creationTime, nonce))
+
+	return &DeviceToken{
+		AccessToken: accessToken,
+		TokenType:   "bearer",
+		ExpiresIn:   3600,
+	}, &deviceTokenMeta{
+		CreationTime: creationTime,
+		Nonce:        nonce,
+	}
+}
+
+// Returns the number of seconds until the device code expires
+func (g *internalDeviceGrant) expiresIn() int {
+	return deviceCodeLifetime - int(time.Now().Sub(g.CreationTime).Seconds())
+}
+
+// Returns the time for which the grant is retained. Expired grants are retained
+// for another lifetime so that polling devices are told that the code expired.
+func (g *internalDeviceGrant) retention() time.Duration {
+	return time.Until(g.CreationTime.Add(2 * deviceCodeLifetime * time.Second))
+}
+
+// Looks up a device authorization in the cache.
+// Returns nil if it was not found.
+func getDeviceGrant(deviceCode string) (*internalDeviceGrant, error) {
+	jsonBytes, err := store.Get(deviceGrantsSet, deviceCode)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
+
+	var grant internalDeviceGrant
+	err = json.Unmarshal(jsonBytes, &grant)
+	if err != nil {
+		return nil, err
+	}
+
+	return &grant, nil
+}
+
+func getDeviceGrantByUserCode(userCode string) (string, *internalDeviceGrant, error) {
+	deviceCodeBytes, err := store.Get(deviceUserCodesSet, normalizeUserCode(userCode))
+	if err != nil || deviceCodeBytes == nil {
+		return "", nil, err
+	}
+
+	deviceCode := string(deviceCodeBytes)
+	grant, err := getDeviceGrant(deviceCode)
+	if grant == nil || err != nil || grant.expiresIn() <= 0 {
+		return "", nil, err
+	}
+
+	return deviceCode, grant, nil
+}
+
+func putDeviceGrant(deviceCode string, grant *internalDeviceGrant) error {
+	jsonBytes, err := json.Marshal(grant)
+	if err != nil {
+		panic(err)
+	}
+
+	return store.Set(deviceGrantsSet, deviceCode, jsonBytes, grant.retention())
+}
+
+func removeDeviceGrant(deviceCode string, grant *internalDeviceGrant) {
+	_, err := store.Delete(deviceGrantsSet, deviceCode)
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = store.Delete(deviceUserCodesSet, grant.UserCode)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Looks up an access token in the cache.
+// Returns nil if the token was not found.
+func getDeviceToken(accessToken string) (*internalDeviceToken, error) {
+	jsonBytes, err := store.Get(deviceTokensSet, accessToken)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
+
+	var token internalDeviceToken
+	err = json.Unmarshal(jsonBytes, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Describes the token as per RFC 7662.
+func (t *internalDeviceToken) info() *TokenInfo {
+	return &TokenInfo{
+		Active:    true,
+		Scope:     t.Meta.Scope,
+		ClientID:  t.Meta.ClientID,
+		TokenType: "bearer",
+		Exp:       t.Meta.CreationTime.Add(time.Duration(t.Token.ExpiresIn) * time.Second).Unix(),
+		Iat:       t.Meta.CreationTime.Unix(),
+		Subject:   t.Meta.Subject,
+		Flow:      "urn:ietf:params:oauth:grant-type:device_code",
+	}
+}
+
+func invalidateDeviceToken(accessToken string) {
+	_, err := store.Delete(deviceTokensSet, accessToken)
+	if err != nil {
+		log.Println(err)
+	}
+}
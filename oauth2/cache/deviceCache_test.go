@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestDeviceFlow tests the polling of a device authorization until the user approves it
+func TestDeviceFlow(t *testing.T) {
+	grant, err := NewDeviceGrant("clientID", "openid")
+	if err != nil {
+		t.Fatalf("Could not generate device grant:\n%s\n", err)
+	}
+
+	_, err = NewDeviceToken(grant.DeviceCode, "clientID", config.TokenLifetimes{})
+	if err != ErrAuthorizationPending {
+		t.Fatalf("Expected authorization_pending, got: %v", err)
+	}
+
+	// Polling again right away must slow the device down
+	_, err = NewDeviceToken(grant.DeviceCode, "clientID", config.TokenLifetimes{})
+	if err != ErrSlowDown {
+		t.Fatalf("Expected slow_down, got: %v", err)
+	}
+
+	_, err = NewDeviceToken(grant.DeviceCode, "otherClientID", config.TokenLifetimes{})
+	if err != ErrInvalidDeviceCode {
+		t.Fatalf("Device code accepted for another client: %v", err)
+	}
+
+	// Users may enter the code in lowercase and without the dash
+	userCode := strings.ToLower(strings.Replace(grant.UserCode, "-", "", 1))
+	found, err := GetDeviceGrant(userCode)
+	if err != nil || found == nil || found.DeviceCode != grant.DeviceCode || found.Interval != 2*devicePollingInterval {
+		t.Fatalf("Device grant not found by user code: %+v, %v", found, err)
+	}
+
+	resolved, err := ResolveDeviceGrant(userCode, "oa2buser", true)
+	if err != nil || !resolved {
+		t.Fatalf("Device grant not approved: %v", err)
+	}
+
+	if resolved, _ = ResolveDeviceGrant(userCode, "oa2buser", false); resolved {
+		t.Fatal("User code used twice")
+	}
+
+	token, err := NewDeviceToken(grant.DeviceCode, "clientID", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatalf("Could not generate token:\n%s\n", err)
+	}
+
+	info, err := IntrospectToken(token.AccessToken, "")
+	if err != nil || !info.Active || info.Subject != "oa2buser" || info.Scope != "openid" {
+		t.Fatalf("Unexpected token info: %+v, %v", info, err)
+	}
+
+	// The device code is consumed by the token
+	_, err = NewDeviceToken(grant.DeviceCode, "clientID", config.TokenLifetimes{})
+	if err != ErrInvalidDeviceCode {
+		t.Fatalf("Device code used twice: %v", err)
+	}
+
+	invalidateDeviceToken(token.AccessToken)
+}
+
+// TestDeviceFlowDenied tests the polling of denied and expired device authorizations
+func TestDeviceFlowDenied(t *testing.T) {
+	grant, err := NewDeviceGrant("clientID", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := ResolveDeviceGrant(grant.UserCode, "", false)
+	if err != nil || !resolved {
+		t.Fatalf("Device grant not denied: %v", err)
+	}
+
+	_, err = NewDeviceToken(grant.DeviceCode, "clientID", config.TokenLifetimes{})
+	if err != ErrAccessDenied {
+		t.Fatalf("Expected access_denied, got: %v", err)
+	}
+
+	grant, err = NewDeviceGrant("clientID", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internal, err := getDeviceGrant(grant.DeviceCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internal.CreationTime = time.Now().Add(-deviceCodeLifetime * time.Second)
+	err = putDeviceGrant(grant.DeviceCode, internal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewDeviceToken(grant.DeviceCode, "clientID", config.TokenLifetimes{})
+	if err != ErrExpiredToken {
+		t.Fatalf("Expected expired_token, got: %v", err)
+	}
+
+	if found, _ := GetDeviceGrant(grant.UserCode); found != nil {
+		t.Fatal("Expired user code accepted")
+	}
+
+	removeDeviceGrant(grant.DeviceCode, internal)
+}
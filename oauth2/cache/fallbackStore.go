@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Interval at which a store which became unavailable is checked for being back
+const storeRetryInterval = 5 * time.Second
+
+// A store on a server, which may become unavailable
+type remoteStore interface {
+	Store
+
+	// ping checks if the server can be reached
+	ping() error
+
+	// unavailable checks if an error returned by the store means that the server could not be reached
+	unavailable(err error) bool
+}
+
+// Keeps the cache working while its store is unavailable, as per the FailOpen policy.
+// Once an operation finds the primary store unavailable, the store is degraded: the operations
+// are served by an in-memory store, with a warning, until the primary store is back.
+// The records stored in the meantime are then resynced to it, while the counters are discarded.
+// Records stored before the primary store became unavailable are not found while it is degraded,
+// hence tokens cannot be revoked meanwhile, as deleting them from the fallback would not outlast the resync.
+type fallbackStore struct {
+	primary remoteStore
+
+	// The lock is held for reading by the operations served by the fallback,
+	// so that none of them is lost while the records are resynced.
+	mut           sync.RWMutex
+	fallback      *memoryStore // nil unless degraded
+	degradedSince time.Time
+	lastErr       error
+
+	// Closed by Close to stop waiting for the primary store to be back
+	done       chan struct{}
+	closeOnce  sync.Once
+	recovering sync.WaitGroup
+}
+
+func newFallbackStore(primary remoteStore) *fallbackStore {
+	return &fallbackStore{primary: primary, done: make(chan struct{})}
+}
+
+// Runs the operation against the primary store, or against the fallback if it is unavailable
+func (s *fallbackStore) do(op func(store Store) error) error {
+	s.mut.RLock()
+	if s.fallback != nil {
+		defer s.mut.RUnlock()
+		return op(s.fallback)
+	}
+	s.mut.RUnlock()
+
+	err := op(s.primary)
+	if err == nil || !s.primary.unavailable(err) {
+		return err
+	}
+
+	s.degrade(err)
+	return s.do(op)
+}
+
+// Switches to the fallback, unless done already, and starts waiting for the primary store to be back
+func (s *fallbackStore) degrade(err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.lastErr = err
+	if s.fallback != nil {
+		return
+	}
+
+	log.Println("WARNING: Store unavailable, keeping records in memory until it is back: " + err.Error())
+	s.fallback = newMemoryStore()
+	s.degradedSince = time.Now()
+
+	s.recovering.Add(1)
+	go func() {
+		defer s.recovering.Done()
+
+		for !s.recover() {
+			select {
+			case <-s.done:
+				return
+			case <-time.After(storeRetryInterval):
+			}
+		}
+	}()
+}
+
+// Checks if the primary store is back and resyncs the records stored in the fallback to it.
+// Returns true once the primary store serves the operations again.
+func (s *fallbackStore) recover() bool {
+	err := s.primary.ping()
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.fallback == nil {
+		return true
+	} else if err != nil {
+		s.lastErr = err
+		return false
+	}
+
+	resynced := 0
+	for set, records := range s.fallback.sets {
+		for key, record := range records {
+			if expiredAt(record.expiresAt) {
+				continue
+			}
+
+			ttl := NoExpiry
+			if !record.expiresAt.IsZero() {
+				ttl = time.Until(record.expiresAt)
+			}
+
+			// Records are resynced again on the next attempt if the store goes away meanwhile
+			err = s.primary.Set(set, key, record.value, ttl)
+			if err != nil {
+				s.lastErr = err
+				log.Println("Could not resync the records to the store: " + err.Error())
+				return false
+			}
+
+			resynced++
+		}
+	}
+
+	log.Printf("Store is back after %s, %d records resynced and %d counters discarded\n",
+		time.Since(s.degradedSince).Round(time.Second), resynced, len(s.fallback.counters)+len(s.fallback.rateLimits))
+	s.fallback = nil
+	s.lastErr = nil
+	return true
+}
+
+// Returns the time since which the store is degraded along with the error which caused it,
+// or the zero time if it is not degraded.
+func (s *fallbackStore) degraded() (time.Time, error) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	if s.fallback == nil {
+		return time.Time{}, nil
+	}
+
+	return s.degradedSince, s.lastErr
+}
+
+// Returns ErrStoreDegraded if the store is a degraded fallback store
+func checkStoreDegraded() error {
+	if fallback, ok := store.(*fallbackStore); ok {
+		if since, _ := fallback.degraded(); !since.IsZero() {
+			return ErrStoreDegraded
+		}
+	}
+
+	return nil
+}
+
+func (s *fallbackStore) Get(set, key string) (value []byte, err error) {
+	err = s.do(func(store Store) error {
+		value, err = store.Get(set, key)
+		return err
+	})
+
+	return value, err
+}
+
+func (s *fallbackStore) GetAll(set string) (records map[string][]byte, err error) {
+	err = s.do(func(store Store) error {
+		records, err = store.GetAll(set)
+		return err
+	})
+
+	return records, err
+}
+
+func (s *fallbackStore) Set(set, key string, value []byte, ttl time.Duration) error {
+	return s.do(func(store Store) error {
+		return store.Set(set, key, value, ttl)
+	})
+}
+
+func (s *fallbackStore) SetNX(set, key string, value []byte, ttl time.Duration) (stored bool, err error) {
+	err = s.do(func(store Store) error {
+		stored, err = store.SetNX(set, key, value, ttl)
+		return err
+	})
+
+	return stored, err
+}
+
+func (s *fallbackStore) Delete(set, key string) (deleted bool, err error) {
+	err = s.do(func(store Store) error {
+		deleted, err = store.Delete(set, key)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (s *fallbackStore) CompareAndDelete(set, key string, value []byte) (deleted bool, err error) {
+	err = s.do(func(store Store) error {
+		deleted, err = store.CompareAndDelete(set, key, value)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (s *fallbackStore) Incr(key string, window time.Duration) (value int, err error) {
+	err = s.do(func(store Store) error {
+		value, err = store.Incr(key, window)
+		return err
+	})
+
+	return value, err
+}
+
+func (s *fallbackStore) Hit(key string, limit RateLimit) (allowed bool, err error) {
+	err = s.do(func(store Store) error {
+		allowed, err = store.Hit(key, limit)
+		return err
+	})
+
+	return allowed, err
+}
+
+// Stops waiting for the primary store to be back, if degraded, and closes it
+func (s *fallbackStore) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	s.recovering.Wait()
+
+	return s.primary.Close()
+}
+
+func (s *fallbackStore) ping() error {
+	return s.do(func(store Store) error {
+		if primary, ok := store.(remoteStore); ok {
+			return primary.ping()
+		}
+
+		return nil
+	})
+}
+
+// Removes the expired records and counters of the fallback, if degraded
+func (s *fallbackStore) housekeep() int {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	if s.fallback == nil {
+		return 0
+	}
+
+	return s.fallback.housekeep()
+}
@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// A store which can be taken down, standing in for Redis
+type flakyStore struct {
+	*memoryStore
+	down atomic.Bool
+}
+
+var errStoreDown = errors.New("store is down")
+
+func (s *flakyStore) Get(set, key string) ([]byte, error) {
+	if s.down.Load() {
+		return nil, errStoreDown
+	}
+
+	return s.memoryStore.Get(set, key)
+}
+
+func (s *flakyStore) Set(set, key string, value []byte, ttl time.Duration) error {
+	if s.down.Load() {
+		return errStoreDown
+	}
+
+	return s.memoryStore.Set(set, key, value, ttl)
+}
+
+func (s *flakyStore) SetNX(set, key string, value []byte, ttl time.Duration) (bool, error) {
+	if s.down.Load() {
+		return false, errStoreDown
+	}
+
+	return s.memoryStore.SetNX(set, key, value, ttl)
+}
+
+func (s *flakyStore) Incr(key string, window time.Duration) (int, error) {
+	if s.down.Load() {
+		return 0, errStoreDown
+	}
+
+	return s.memoryStore.Incr(key, window)
+}
+
+func (s *flakyStore) ping() error {
+	if s.down.Load() {
+		return errStoreDown
+	}
+
+	return nil
+}
+
+func (s *flakyStore) unavailable(err error) bool {
+	return err == errStoreDown
+}
+
+// TestFallbackStore checks that the records are kept in memory while the primary store
+// is unavailable, and resynced to it once it is back.
+func TestFallbackStore(t *testing.T) {
+	primary := &flakyStore{memoryStore: newMemoryStore()}
+	s := newFallbackStore(primary)
+
+	previous := store
+	store = s
+	defer func() {
+		s.Close()
+		store = previous
+	}()
+
+	primary.Set("tokens", "before", []byte("before"), time.Minute)
+	if health := CheckStore(); health.Status != StoreOK {
+		t.Fatalf("Unexpected health: %+v", health)
+	}
+
+	primary.down.Store(true)
+	err := s.Set("tokens", "during", []byte("during"), time.Minute)
+	if err != nil {
+		t.Fatalf("Record not kept in memory: %v", err)
+	}
+
+	s.Set("tokens", "expired", []byte("expired"), -time.Second)
+	s.Incr("counter", time.Minute)
+
+	health := CheckStore()
+	if health.Status != StoreDegraded || health.DegradedSince == nil || health.Error != errStoreDown.Error() {
+		t.Fatalf("Unexpected health: %+v", health)
+	}
+
+	// Records stored before the primary store went down are not found meanwhile
+	value, err := s.Get("tokens", "before")
+	if err != nil || value != nil {
+		t.Fatalf("Unexpected record: %q, %v", value, err)
+	}
+
+	if s.recover() {
+		t.Fatal("Recovered while the primary store is down")
+	}
+
+	primary.down.Store(false)
+	if !s.recover() {
+		t.Fatal("Did not recover once the primary store was back")
+	}
+
+	records, _ := primary.GetAll("tokens")
+	if len(records) != 2 || string(records["during"]) != "during" {
+		t.Fatalf("Unexpected records after resync: %q", records)
+	}
+
+	count, _ := s.Incr("counter", time.Minute)
+	if count != 1 {
+		t.Fatalf("Counter kept after resync: %d", count)
+	}
+
+	if health := CheckStore(); health.Status != StoreOK {
+		t.Fatalf("Unexpected health: %+v", health)
+	}
+}
+
+// TestFallbackStoreRevocation checks that tokens cannot be revoked while the store is degraded,
+// so that a revoked token is not brought back by the resync, and can be revoked once it is back.
+func TestFallbackStoreRevocation(t *testing.T) {
+	primary := &flakyStore{memoryStore: newMemoryStore()}
+	s := newFallbackStore(primary)
+
+	previous := store
+	store = s
+	defer func() {
+		s.Close()
+		store = previous
+	}()
+
+	token, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary.down.Store(true)
+	if VerifyROPCToken(token.AccessToken) {
+		t.Fatal("Token issued before the outage found while degraded")
+	}
+
+	revoked, err := RevokeToken(token.AccessToken, "", "clientID")
+	if err != ErrStoreDegraded || revoked {
+		t.Fatalf("Token revoked while degraded: %v, %v", revoked, err)
+	}
+
+	err = revokeTokenFamily(ropcTokensSet, "family")
+	if err != ErrStoreDegraded {
+		t.Fatalf("Token family revoked while degraded: %v", err)
+	}
+
+	primary.down.Store(false)
+	if !s.recover() {
+		t.Fatal("Did not recover once the primary store was back")
+	}
+
+	revoked, err = RevokeToken(token.AccessToken, "", "clientID")
+	if err != nil || !revoked {
+		t.Fatalf("Token not revoked once the store was back: %v, %v", revoked, err)
+	}
+
+	if VerifyROPCToken(token.AccessToken) || ROPCRefreshTokenExists(token.RefreshToken, false) {
+		t.Fatal("Revoked token still valid")
+	}
+}
@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+const (
+	// Operations recorded in the file of a fileStore
+	fileOpSet    = "set"
+	fileOpDelete = "del"
+
+	// Number of entries the file must hold before it is compacted
+	compactionMinEntries = 1000
+)
+
+// Persists the records to a file, so that they survive restarts without requiring a server.
+// The records are held in memory, while every change is appended to the file as a line of JSON.
+// The file is replayed when the store is opened, and compacted by the housekeeping service once
+// most of its entries are obsolete, which reclaims the deleted and expired records.
+// Writes are not synced to the disk, hence records survive restarts of OA2B but not of the machine.
+// Counters are only held in memory.
+type fileStore struct {
+	memory  *memoryStore
+	path    string
+	file    *os.File
+	entries int
+}
+
+// An entry of the file, which either stores or deletes a record
+type fileEntry struct {
+	Op        string    `json:"op"`
+	Set       string    `json:"set"`
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Opens the file at 'path', creating it if needed, and loads its records
+func openFileStore(path string) (*fileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &fileStore{memory: newMemoryStore(), path: path, file: file}
+	err = s.load()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Replays the entries of the file. An incomplete last entry, which is left behind
+// if OA2B stops while writing it, is truncated so that it does not corrupt the next one.
+func (s *fileStore) load() error {
+	reader := bufio.NewReader(s.file)
+	var offset int64
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				log.Printf("Truncating incomplete entry at the end of %s\n", s.path)
+				return s.file.Truncate(offset)
+			}
+
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		offset += int64(len(line))
+		s.entries++
+
+		var entry fileEntry
+		err = json.Unmarshal(line, &entry)
+		if err != nil {
+			log.Printf("Skipping corrupt entry of %s: %s\n", s.path, err)
+			continue
+		}
+
+		s.replay(entry)
+	}
+}
+
+// Applies the entry to the records in memory. The lock must be held, except while loading.
+func (s *fileStore) replay(entry fileEntry) {
+	switch entry.Op {
+	case fileOpSet:
+		if !expiredAt(entry.ExpiresAt) {
+			s.memory.set(entry.Set, entry.Key, memoryRecord{value: entry.Value, expiresAt: entry.ExpiresAt})
+		}
+	case fileOpDelete:
+		delete(s.memory.sets[entry.Set], entry.Key)
+	}
+}
+
+// Appends the entry to the file and applies it. The lock must be held.
+func (s *fileStore) apply(entry fileEntry) error {
+	jsonBytes, err := json.Marshal(entry)
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = s.file.Write(append(jsonBytes, '\n'))
+	if err != nil {
+		return err
+	}
+
+	s.entries++
+	s.replay(entry)
+	return nil
+}
+
+func (s *fileStore) Get(set, key string) ([]byte, error) {
+	return s.memory.Get(set, key)
+}
+
+func (s *fileStore) GetAll(set string) (map[string][]byte, error) {
+	return s.memory.GetAll(set)
+}
+
+func (s *fileStore) Set(set, key string, value []byte, ttl time.Duration) error {
+	s.memory.mut.Lock()
+	defer s.memory.mut.Unlock()
+
+	return s.apply(fileEntry{Op: fileOpSet, Set: set, Key: key, Value: value, ExpiresAt: expiryOf(ttl)})
+}
+
+func (s *fileStore) SetNX(set, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.memory.mut.Lock()
+	defer s.memory.mut.Unlock()
+
+	if _, found := s.memory.get(set, key); found {
+		return false, nil
+	}
+
+	err := s.apply(fileEntry{Op: fileOpSet, Set: set, Key: key, Value: value, ExpiresAt: expiryOf(ttl)})
+	return err == nil, err
+}
+
+func (s *fileStore) Delete(set, key string) (bool, error) {
+	s.memory.mut.Lock()
+	defer s.memory.mut.Unlock()
+
+	if _, found := s.memory.get(set, key); !found {
+		return false, nil
+	}
+
+	err := s.apply(fileEntry{Op: fileOpDelete, Set: set, Key: key})
+	return err == nil, err
+}
+
+func (s *fileStore) CompareAndDelete(set, key string, value []byte) (bool, error) {
+	s.memory.mut.Lock()
+	defer s.memory.mut.Unlock()
+
+	record, found := s.memory.get(set, key)
+	if !found || !bytes.Equal(record.value, value) {
+		return false, nil
+	}
+
+	err := s.apply(fileEntry{Op: fileOpDelete, Set: set, Key: key})
+	return err == nil, err
+}
+
+func (s *fileStore) Incr(key string, window time.Duration) (int, error) {
+	return s.memory.Incr(key, window)
+}
+
+func (s *fileStore) Hit(key string, limit RateLimit) (bool, error) {
+	return s.memory.Hit(key, limit)
+}
+
+func (s *fileStore) Close() error {
+	s.memory.mut.Lock()
+	defer s.memory.mut.Unlock()
+
+	err := s.file.Sync()
+	if err != nil {
+		return err
+	}
+
+	return s.file.Close()
+}
+
+// Removes the expired records, counters and rate limits. Returns the number of them removed.
+func (s *fileStore) housekeep() int {
+	return s.memory.housekeep()
+}
+
+// Compacts the file if most of its entries are obsolete.
+// Returns the number of entries reclaimed.
+func (s *fileStore) compactIfObsolete() (int, error) {
+	s.memory.mut.Lock()
+	defer s.memory.mut.Unlock()
+
+	live := 0
+	for _, records := range s.memory.sets {
+		for _, record := range records {
+			if !expiredAt(record.expiresAt) {
+				live++
+			}
+		}
+	}
+
+	if s.entries < compactionMinEntries || s.entries < 2*live {
+		return 0, nil
+	}
+
+	entries := s.entries
+	err := s.compact()
+	if err != nil {
+		return 0, err
+	}
+
+	return entries - s.entries, nil
+}
+
+// Rewrites the file with an entry for every live record. The new file replaces
+// the previous one only once it is complete, and is appended to from then on. The lock must be held.
+func (s *fileStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	entries := 0
+	for set, records := range s.memory.sets {
+		for key, record := range records {
+			if expiredAt(record.expiresAt) {
+				continue
+			}
+
+			jsonBytes, err := json.Marshal(fileEntry{Op: fileOpSet, Set: set, Key: key, Value: record.value, ExpiresAt: record.expiresAt})
+			if err != nil {
+				panic(err)
+			}
+
+			writer.Write(append(jsonBytes, '\n'))
+			entries++
+		}
+	}
+
+	err = writer.Flush()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.file.Close()
+	s.file = tmp
+	s.entries = entries
+	return nil
+}
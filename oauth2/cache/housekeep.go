@@ -1,37 +1,245 @@
 package cache
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
-	"github.com/gomodule/redigo/redis"
 )
 
-// Array of housekeeping service functions
-var housekeepingFuncs = [...]func(redis.Conn){
-	authCodeTokenHousekeep, authCodeGrantHousekeep,
-	implicitTokenHousekeep, ropcTokenHousekeep,
-	clientCredsTokenHousekeep,
+// Set which holds the leases of the shared housekeeping tasks
+const housekeepingLeasesSet = "OA2B_HousekeepingLeases"
+
+// A housekeeping task, which runs at its own interval in a goroutine of its own.
+// Every run borrows its connections from the store, hence a task outlives the loss of a connection.
+//
+// name: identifies the task in the configuration, the logs and the stats
+// interval: time between two runs, the task is disabled if zero
+// shared: the task sweeps the records shared by every replica of OA2B, hence it is only run by
+// the replica which takes its lease, as described at takeLease
+// run: performs the task and returns the number of records or entries deleted
+type housekeepingTask struct {
+	name     string
+	interval time.Duration
+	shared   bool
+	run      func() (int, error)
+
+	mut   sync.Mutex
+	stats HousekeepingStats
 }
 
-func init() {
-	// Background goroutine that fires the housekeeping functions every
-	// 5 minutes for cleaning up expired grants and tokens.
-	go func() {
-		log.Println("Housekeeping service has started")
-		conn := NewConn()
-		wg := sync.WaitGroup{}
-
-		for {
-			for _, hkFunc := range housekeepingFuncs {
-				wg.Add(1)
-				hkFunc(conn)
-				wg.Done()
+// HousekeepingStats describes the runs of a housekeeping task.
+//
+// Runs: the number of times the task ran on this replica
+// Skipped: the number of times the task was left to another replica
+// LeaseFailures: the number of times the task was not run since its lease could not be taken
+// Deleted: the number of records or entries deleted by the task in total, and during its last run
+// Duration: the time taken by the task in total, and by its last run, in milliseconds
+type HousekeepingStats struct {
+	Task               string     `json:"task"`
+	IntervalSeconds    float64    `json:"interval_seconds"`
+	Runs               int        `json:"runs"`
+	Skipped            int        `json:"skipped"`
+	LeaseFailures      int        `json:"lease_failures"`
+	Deleted            int        `json:"deleted"`
+	LastDeleted        int        `json:"last_deleted"`
+	DurationMillis     float64    `json:"duration_ms"`
+	LastDurationMillis float64    `json:"last_duration_ms"`
+	LastRun            *time.Time `json:"last_run,omitempty"`
+	LastError          string     `json:"last_error,omitempty"`
+}
+
+// The housekeeping tasks. Redis expires the records by itself, the other stores need them to be swept.
+var housekeepingTasks = []*housekeepingTask{
+	{name: "expiry", interval: 5 * time.Minute, run: expireRecords},
+	{name: "compaction", interval: 5 * time.Minute, run: compactStore},
+	{name: "indexes", interval: time.Hour, shared: true, run: sweepRefreshTokenIndexes},
+}
+
+// Identifies this replica of OA2B as the holder of leases
+var replicaID = replicaName()
+
+var housekeeping sync.Once
+
+// ConfigureHousekeeping sets the intervals of the housekeeping tasks from a comma-separated list
+// of task=interval pairs, such as "expiry=1m,indexes=6h". An interval of 0 disables the task.
+// The tasks are expiry, compaction and indexes. It must be called before the store is opened.
+func ConfigureHousekeeping(intervals string) error {
+	for _, pair := range strings.Split(intervals, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid housekeeping interval: %s", pair)
+		}
+
+		task := findHousekeepingTask(strings.TrimSpace(parts[0]))
+		if task == nil {
+			return fmt.Errorf("unknown housekeeping task: %s", parts[0])
+		}
+
+		interval, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || interval < 0 {
+			return fmt.Errorf("invalid housekeeping interval: %s", pair)
+		}
+
+		task.interval = interval
+	}
+
+	return nil
+}
+
+// Starts a goroutine for every enabled housekeeping task
+func startHousekeeping() {
+	housekeeping.Do(func() {
+		for _, task := range housekeepingTasks {
+			if task.interval > 0 {
+				go task.schedule()
 			}
+		}
+
+		log.Println("Housekeeping service has started")
+	})
+}
+
+// GetHousekeepingStats returns the stats of every housekeeping task
+func GetHousekeepingStats() []HousekeepingStats {
+	stats := make([]HousekeepingStats, len(housekeepingTasks))
+	for i, task := range housekeepingTasks {
+		task.mut.Lock()
+		stats[i] = task.stats
+		task.mut.Unlock()
+
+		stats[i].Task = task.name
+		stats[i].IntervalSeconds = task.interval.Seconds()
+	}
+
+	return stats
+}
 
-			utils.Sleep(5 * time.Second)
+// Runs the task at its interval
+func (t *housekeepingTask) schedule() {
+	for {
+		utils.Sleep(t.interval)
+		t.runOnce()
+	}
+}
+
+// Runs the task, unless another replica holds its lease, and records its stats
+func (t *housekeepingTask) runOnce() {
+	if t.shared {
+		leased, err := takeLease(t.name, replicaID, t.interval)
+		if err != nil {
+			log.Printf("Housekeeping task %s could not take its lease: %s\n", t.name, err)
+			t.mut.Lock()
+			t.stats.LeaseFailures++
+			t.stats.LastError = err.Error()
+			t.mut.Unlock()
+			return
+		} else if !leased {
+			t.mut.Lock()
+			t.stats.Skipped++
+			t.mut.Unlock()
+			return
+		}
+	}
+
+	start := time.Now()
+	deleted, err := t.runRecovered()
+	if err != nil {
+		log.Printf("Housekeeping task %s failed: %s\n", t.name, err)
+	}
+
+	t.record(start, deleted, err)
+}
+
+// Runs the task, recovering from a panic so that the task runs again at its next interval
+func (t *housekeepingTask) runRecovered() (deleted int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
 		}
 	}()
+
+	return t.run()
+}
+
+// Records the stats of a run which started at 'start'
+func (t *housekeepingTask) record(start time.Time, deleted int, err error) {
+	duration := float64(time.Since(start)) / float64(time.Millisecond)
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.stats.Runs++
+	t.stats.Deleted += deleted
+	t.stats.LastDeleted = deleted
+	t.stats.DurationMillis += duration
+	t.stats.LastDurationMillis = duration
+	t.stats.LastRun = &start
+	t.stats.LastError = ""
+	if err != nil {
+		t.stats.LastError = err.Error()
+	}
+}
+
+// Takes the lease of a shared task for 'replica'. The lease expires after the interval of the task,
+// hence only the replica which takes it runs the task during that interval, while the other replicas
+// skip it. Since the store is shared by the replicas, Redis acts as the lock.
+// The lease is taken from Redis even while the store is degraded, since the in-memory fallback
+// is not shared by the replicas, hence no replica runs the task until Redis is back.
+// Returns true if the lease was taken.
+func takeLease(task, replica string, interval time.Duration) (bool, error) {
+	leases := store
+	if fallback, ok := store.(*fallbackStore); ok {
+		leases = fallback.primary
+	}
+
+	return leases.SetNX(housekeepingLeasesSet, task, []byte(replica), interval)
+}
+
+// Housekeeping task which removes the expired records and counters
+// from the stores which do not remove them by themselves
+func expireRecords() (int, error) {
+	if housekeeper, ok := store.(interface{ housekeep() int }); ok {
+		return housekeeper.housekeep(), nil
+	}
+
+	return 0, nil
+}
+
+// Housekeeping task which compacts the file of the file store
+func compactStore() (int, error) {
+	if compactor, ok := store.(interface{ compactIfObsolete() (int, error) }); ok {
+		return compactor.compactIfObsolete()
+	}
+
+	return 0, nil
+}
+
+// Looks up a housekeeping task by its name. Returns nil if there is none.
+func findHousekeepingTask(name string) *housekeepingTask {
+	for _, task := range housekeepingTasks {
+		if task.name == name {
+			return task
+		}
+	}
+
+	return nil
+}
+
+// Returns a name for this replica, made of its host name, its process ID and a nonce
+func replicaName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), generateNonce(8))
 }
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+func TestConfigureHousekeeping(t *testing.T) {
+	expiry := findHousekeepingTask("expiry")
+	indexes := findHousekeepingTask("indexes")
+	defer func(expiryInterval, indexesInterval time.Duration) {
+		expiry.interval, indexes.interval = expiryInterval, indexesInterval
+	}(expiry.interval, indexes.interval)
+
+	err := ConfigureHousekeeping("expiry=1m, indexes=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expiry.interval != time.Minute || indexes.interval != 0 {
+		t.Fatalf("Unexpected intervals: %s, %s", expiry.interval, indexes.interval)
+	}
+
+	for _, invalid := range []string{"expiry", "unknown=1m", "expiry=soon", "expiry=-1m"} {
+		if ConfigureHousekeeping(invalid) == nil {
+			t.Errorf("%s: accepted", invalid)
+		}
+	}
+}
+
+// TestHousekeepingLease checks that a shared task is only run by the replica holding its lease
+func TestHousekeepingLease(t *testing.T) {
+	runs := 0
+	task := &housekeepingTask{name: "OA2B_LeaseTest", interval: time.Minute, shared: true, run: func() (int, error) {
+		runs++
+		return 2, nil
+	}}
+	defer store.Delete(housekeepingLeasesSet, task.name)
+
+	leased, err := takeLease(task.name, "another replica", task.interval)
+	if err != nil || !leased {
+		t.Fatalf("Lease not taken: %v", err)
+	}
+
+	task.runOnce()
+	if runs != 0 || task.stats.Skipped != 1 {
+		t.Fatalf("Task run while another replica holds its lease")
+	}
+
+	store.Delete(housekeepingLeasesSet, task.name)
+	task.runOnce()
+	task.runOnce()
+	if runs != 1 || task.stats.Runs != 1 || task.stats.Deleted != 2 || task.stats.Skipped != 2 {
+		t.Fatalf("Unexpected stats after %d runs: %+v", runs, task.stats)
+	}
+}
+
+// TestHousekeepingDegradedLease checks that shared tasks are not run while the store is degraded,
+// since every replica would take its own lease from the in-memory fallback
+func TestHousekeepingDegradedLease(t *testing.T) {
+	primary := &flakyStore{memoryStore: newMemoryStore()}
+	primary.down.Store(true)
+	s := newFallbackStore(primary)
+
+	previous := store
+	store = s
+	defer func() {
+		s.Close()
+		store = previous
+	}()
+
+	// Degrades the store
+	s.Get("tokens", "key")
+	if since, _ := s.degraded(); since.IsZero() {
+		t.Fatal("Store not degraded")
+	}
+
+	runs := 0
+	task := &housekeepingTask{name: "OA2B_DegradedLeaseTest", interval: time.Minute, shared: true, run: func() (int, error) {
+		runs++
+		return 0, nil
+	}}
+
+	task.runOnce()
+	if runs != 0 || task.stats.Runs != 0 || task.stats.LastRun != nil {
+		t.Fatalf("Task run while the store is degraded: %+v", task.stats)
+	}
+
+	if task.stats.LeaseFailures != 1 || task.stats.LastError != errStoreDown.Error() {
+		t.Fatalf("Lease failure not recorded: %+v", task.stats)
+	}
+
+	primary.down.Store(false)
+	task.runOnce()
+	if runs != 1 || task.stats.Runs != 1 || task.stats.LastError != "" {
+		t.Fatalf("Task not run once the store was back: %+v", task.stats)
+	}
+}
+
+// TestHousekeepingFailure checks that failing and panicking tasks are recorded and run again
+func TestHousekeepingFailure(t *testing.T) {
+	task := &housekeepingTask{name: "failing", run: func() (int, error) {
+		return 0, errors.New("failed")
+	}}
+
+	task.runOnce()
+	if task.stats.Runs != 1 || task.stats.LastError != "failed" {
+		t.Fatalf("Unexpected stats: %+v", task.stats)
+	}
+
+	task.run = func() (int, error) {
+		panic("panicked")
+	}
+
+	task.runOnce()
+	if task.stats.Runs != 2 || task.stats.LastError != "panic: panicked" {
+		t.Fatalf("Unexpected stats: %+v", task.stats)
+	}
+}
+
+// TestSweepRefreshTokenIndexes checks that the index records of invalidated tokens are removed
+func TestSweepRefreshTokenIndexes(t *testing.T) {
+	token, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer invalidateROPCToken(live.AccessToken)
+
+	invalidateROPCToken(token.AccessToken)
+
+	// Tokens invalidated by other tests may be swept as well
+	removed, err := sweepRefreshTokenIndexes()
+	if err != nil || removed < 2 {
+		t.Fatalf("%d index records removed: %v", removed, err)
+	}
+
+	accessToken, err := lookupRefreshToken(ropcTokensSet, token.RefreshToken)
+	if err != nil || accessToken != "" {
+		t.Fatalf("Index record of an invalidated token kept: %q, %v", accessToken, err)
+	}
+
+	if !ROPCRefreshTokenExists(live.RefreshToken, false) {
+		t.Fatal("Index record of a live token removed")
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"log"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 const (
-	// Redis HSET which holds the issued tokens
+	// Set which holds the issued tokens
 	implicitTokensSet = "OA2B_IG_Tokens"
 
 	// ImplicitFlowID is prepended to access tokens issued by the Implicit Grant flow
@@ -21,17 +21,22 @@ const (
 // https://tools.ietf.org/html/rfc6749#section-4.2.2
 type ImplicitToken struct {
 	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
 	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
 }
 
 // Holds the meta data of an access token
 type implicitTokenMeta struct {
+	ClientID     string    `json:"client_id"`
+	Subject      string    `json:"subject,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
 	CreationTime time.Time `json:"creation_time"`
 	Nonce        string    `json:"nonce"`
 }
 
 // Holds the token as well as its metadata.
-// It is the internal representation of the token inside the Redis cache.
+// It is the internal representation of the token inside the cache.
 type internalImplicitToken struct {
 	Token ImplicitToken     `json:"token"`
 	Meta  implicitTokenMeta `json:"meta"`
@@ -39,54 +44,76 @@ type internalImplicitToken struct {
 
 // NewImplicitToken issues new access tokens for the Implicit Grant flow.
 // It generates and stores a token and stores it along with its meta data
-// in the Redis cache.
-func NewImplicitToken() (*ImplicitToken, error) {
-	conn := NewConn()
-	defer CloseConn(conn)
-
+// in the cache. The token expires as per the lifetimes of the client.
+func NewImplicitToken(clientID, subject, scope string, lifetimes config.TokenLifetimes) (*ImplicitToken, error) {
 	var token *ImplicitToken
 	var meta *implicitTokenMeta
-	var err error
-	reply := 1
+	stored := false
 
 	// Generates a new key if a duplicate is encountered
-	for reply == 1 {
+	for !stored {
 		token, meta = generateImplicitToken()
+		token.ExpiresIn = lifetimes.AccessTokenSeconds()
+		token.Scope = scope
+		meta.ClientID = clientID
+		meta.Subject = subject
+		meta.Scope = scope
 
-		reply, err = redis.Int(conn.Do("HEXISTS", implicitTokensSet, token.AccessToken))
+		jsonBytes, err := json.Marshal(internalImplicitToken{Token: *token, Meta: *meta})
+		if err != nil {
+			panic(err)
+		}
+
+		stored, err = store.SetNX(implicitTokensSet, token.AccessToken, jsonBytes, time.Duration(token.ExpiresIn)*time.Second)
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
 	}
 
-	jsonBytes, err := json.Marshal(internalImplicitToken{Token: *token, Meta: *meta})
-	if err != nil {
-		panic(err)
+	return token, nil
+}
+
+// VerifyImplicitToken checks if the token exists in the cache.
+// Returns true if token found, false otherwise.
+func VerifyImplicitToken(token string) bool {
+	jsonBytes, err := store.Get(implicitTokensSet, token)
+	return err == nil && jsonBytes != nil
+}
+
+// Looks up an access token in the cache.
+// Returns nil if the token was not found.
+func getImplicitToken(accessToken string) (*internalImplicitToken, error) {
+	jsonBytes, err := store.Get(implicitTokensSet, accessToken)
+	if err != nil || jsonBytes == nil {
+		return nil, err
 	}
 
-	_, err = conn.Do("HSET", implicitTokensSet, token.AccessToken, string(jsonBytes))
+	var token internalImplicitToken
+	err = json.Unmarshal(jsonBytes, &token)
 	if err != nil {
 		return nil, err
 	}
 
-	return token, nil
+	return &token, nil
 }
 
-// VerifyImplicitToken checks if the token exists in the Redis cache.
-// Returns true if token found, false otherwise.
-func VerifyImplicitToken(token string) bool {
-	conn := NewConn()
-	defer CloseConn(conn)
-
-	_, err := redis.String(conn.Do("HGET", implicitTokensSet, token))
-	return err == nil
+// Describes the token as per RFC 7662.
+func (t *internalImplicitToken) info() *TokenInfo {
+	return &TokenInfo{
+		Active:    true,
+		Scope:     t.Meta.Scope,
+		ClientID:  t.Meta.ClientID,
+		TokenType: "bearer",
+		Exp:       t.Meta.CreationTime.Add(time.Duration(t.Token.ExpiresIn) * time.Second).Unix(),
+		Iat:       t.Meta.CreationTime.Unix(),
+		Subject:   t.Meta.Subject,
+		Flow:      "implicit",
+	}
 }
 
 func invalidateImplicitToken(accessToken string) {
-	conn := NewConn()
-	defer CloseConn(conn)
-	_, err := conn.Do("HDEL", implicitTokensSet, accessToken)
+	_, err := store.Delete(implicitTokensSet, accessToken)
 	if err != nil {
 		log.Println(err)
 	}
@@ -102,39 +129,11 @@ func generateImplicitToken() (*ImplicitToken, *implicitTokenMeta) {
 	accessToken := ImplicitFlowID + hash(fmt.Sprintf("%s%s", creationTime, nonce))
 
 	return &ImplicitToken{
-			AccessToken: accessToken,
-			ExpiresIn:   3600,
-		}, &implicitTokenMeta{
-			CreationTime: creationTime,
-			Nonce:        nonce,
-		}
-}
-
-// Housekeeping service for the Implicit tokens set
-func implicitTokenHousekeep(conn redis.Conn) {
-	var token internalImplicitToken
-	var err error
-	var diff time.Duration
-
-	items, err := redis.ByteSlices(conn.Do("HGETALL", implicitTokensSet))
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	for i := 1; i < len(items); i += 2 {
-		err = json.Unmarshal(items[i], &token)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-
-		diff = time.Now().Sub(token.Meta.CreationTime)
-		if diff >= time.Hour {
-			_, err = conn.Do("HDEL", implicitTokensSet, items[i-1])
-			if err != nil {
-				log.Println(err)
-			}
-		}
+		AccessToken: accessToken,
+		TokenType:   "bearer",
+		ExpiresIn:   3600,
+	}, &implicitTokenMeta{
+		CreationTime: creationTime,
+		Nonce:        nonce,
 	}
 }
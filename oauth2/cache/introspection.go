@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"strings"
+	"time"
+)
+
+// TokenInfo holds the meta information of a token as described in
+// RFC 7662 Section 2.2 (https://tools.ietf.org/html/rfc7662#section-2.2)
+//
+// Flow is an extension which holds the grant type of the flow that issued the token.
+type TokenInfo struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Flow      string `json:"flow,omitempty"`
+}
+
+// Token type hints defined in RFC 7009 Section 2.1 (https://tools.ietf.org/html/rfc7009#section-2.1)
+const (
+	AccessTokenHint  = "access_token"
+	RefreshTokenHint = "refresh_token"
+)
+
+// IntrospectToken looks up a token issued by any of the flows and describes it.
+// The flow is determined by the identifier prepended to every token.
+// The hint, if any, decides whether the token is first looked up as an access or
+// a refresh token. The search is extended to the other kind if it isn't found.
+// Unknown and expired tokens are reported as inactive.
+// Refer: https://tools.ietf.org/html/rfc7662#section-2.2
+func IntrospectToken(token, tokenTypeHint string) (*TokenInfo, error) {
+	var info *TokenInfo
+	var err error
+
+	lookupAccess := func() (*TokenInfo, error) {
+		switch {
+		case strings.HasPrefix(token, AuthCodeFlowID):
+			t, err := getAuthCodeToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(false), nil
+		case strings.HasPrefix(token, ImplicitFlowID):
+			t, err := getImplicitToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(), nil
+		case strings.HasPrefix(token, ROPCFlowID):
+			t, err := getROPCToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(false), nil
+		case strings.HasPrefix(token, ClientCredsFlowID):
+			t, err := getClientCredsToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(), nil
+		case strings.HasPrefix(token, DeviceFlowID):
+			t, err := getDeviceToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(), nil
+		}
+
+		return nil, nil
+	}
+
+	lookupRefresh := func() (*TokenInfo, error) {
+		switch {
+		case strings.HasPrefix(token, AuthCodeFlowID):
+			t, err := findAuthCodeRefreshToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(true), nil
+		case strings.HasPrefix(token, ROPCFlowID):
+			t, err := findROPCRefreshToken(token)
+			if t == nil || err != nil {
+				return nil, err
+			}
+			return t.info(true), nil
+		}
+
+		return nil, nil
+	}
+
+	if tokenTypeHint == RefreshTokenHint {
+		info, err = lookupRefresh()
+		if info == nil && err == nil {
+			info, err = lookupAccess()
+		}
+	} else {
+		info, err = lookupAccess()
+		if info == nil && err == nil {
+			info, err = lookupRefresh()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil || (info.Exp != 0 && time.Now().Unix() >= info.Exp) {
+		return &TokenInfo{Active: false}, nil
+	}
+
+	return info, nil
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestIntrospectToken checks that tokens from every flow are described as active
+// and that unknown and invalidated tokens are described as inactive.
+func TestIntrospectToken(t *testing.T) {
+	code, err := NewAuthCodeGrant(AuthCodeGrant{ClientID: "clientID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authCodeToken, _, err := NewAuthCodeToken(code, "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	implicitToken, err := NewImplicitToken("clientID", "oa2buser", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ropcToken, err := NewROPCToken("clientID", "oa2buser", "read", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCredsToken, err := NewClientCredsToken("clientID", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		token, hint, flow string
+		refresh           bool
+	}{
+		{authCodeToken.AccessToken, "", "authorization_code", false},
+		{authCodeToken.RefreshToken, "", "authorization_code", true},
+		{implicitToken.AccessToken, AccessTokenHint, "implicit", false},
+		{ropcToken.AccessToken, RefreshTokenHint, "password", false},
+		{ropcToken.RefreshToken, RefreshTokenHint, "password", true},
+		{clientCredsToken.AccessToken, "", "client_credentials", false},
+	}
+
+	for _, c := range cases {
+		info, err := IntrospectToken(c.token, c.hint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.Active || info.Flow != c.flow || info.ClientID != "clientID" {
+			t.Errorf("%s: unexpected token info %+v", c.token, info)
+		}
+
+		if !c.refresh && (info.TokenType != "bearer" || info.Exp <= info.Iat) {
+			t.Errorf("%s: unexpected token type or expiry %+v", c.token, info)
+		}
+	}
+
+	invalidateAuthCodeToken(authCodeToken.AccessToken)
+	invalidateImplicitToken(implicitToken.AccessToken)
+	invalidateROPCToken(ropcToken.AccessToken)
+	invalidateClientCredsToken(clientCredsToken.AccessToken)
+
+	for _, token := range []string{authCodeToken.AccessToken, ropcToken.RefreshToken, "", "UNKNOWN"} {
+		info, err := IntrospectToken(token, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Active {
+			t.Errorf("%q: invalidated or unknown token is active", token)
+		}
+	}
+}
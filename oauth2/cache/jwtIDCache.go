@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"time"
+)
+
+// Set which maps the IDs of the JWT access tokens to the opaque tokens they stand for
+const jwtIDsSet = "OA2B_JWTIDs"
+
+// NewJWTID generates the ID of a JWT access token standing for the opaque 'accessToken'.
+// The opaque token must not be revealed by the JWT, hence its ID is unrelated to it
+// and is mapped to it until 'expiresAt'.
+// Refer: https://tools.ietf.org/html/rfc9068#section-2.2
+func NewJWTID(accessToken string, expiresAt time.Time) (string, error) {
+	var jwtID string
+	stored := false
+
+	// Generates a new ID if a duplicate is encountered
+	for !stored {
+		var err error
+		jwtID = generateNonce(32)
+		stored, err = store.SetNX(jwtIDsSet, jwtID, []byte(accessToken), time.Until(expiresAt))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return jwtID, nil
+}
+
+// ResolveJWTID returns the opaque access token which the JWT with the ID stands for,
+// or an empty string if the ID is unknown or the JWT has expired.
+func ResolveJWTID(jwtID string) (string, error) {
+	accessToken, err := store.Get(jwtIDsSet, jwtID)
+	if err != nil || accessToken == nil {
+		return "", err
+	}
+
+	return string(accessToken), nil
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJWTID(t *testing.T) {
+	jwtID, err := NewJWTID("accessToken", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	} else if jwtID == "accessToken" {
+		t.Fatal("JWT ID reveals the access token")
+	}
+
+	accessToken, err := ResolveJWTID(jwtID)
+	if err != nil || accessToken != "accessToken" {
+		t.Fatalf("JWT ID resolved to %q: %v", accessToken, err)
+	}
+
+	accessToken, err = ResolveJWTID("unknown")
+	if err != nil || accessToken != "" {
+		t.Fatalf("Unknown JWT ID resolved to %q: %v", accessToken, err)
+	}
+
+	store.Delete(jwtIDsSet, jwtID)
+}
@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"sync"
+	"time"
+)
+
+// Stores the records in the memory of the process.
+// They are lost when the server stops.
+type memoryStore struct {
+	mut        sync.Mutex
+	sets       map[string]map[string]memoryRecord
+	counters   map[string]*memoryCounter
+	rateLimits map[string]*memoryRateLimit
+}
+
+// Holds the value of a record along with the time at which it expires
+type memoryRecord struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Holds a counter along with the time at which it expires
+type memoryCounter struct {
+	value     int
+	expiresAt time.Time
+}
+
+// Holds the state of a rate limit along with the time at which it expires
+//
+// hits: the times of the hits let through, for SlidingWindowLog
+// windowStart, current, previous: the start of the current window and the hits counted
+// during it and during the previous one, for SlidingWindowCounter
+// tokens, updatedAt: the tokens left in the bucket when it was last updated, for TokenBucket
+type memoryRateLimit struct {
+	hits              []time.Time
+	windowStart       time.Time
+	current, previous int
+	tokens            float64
+	updatedAt         time.Time
+	expiresAt         time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		sets:       make(map[string]map[string]memoryRecord),
+		counters:   make(map[string]*memoryCounter),
+		rateLimits: make(map[string]*memoryRateLimit),
+	}
+}
+
+func (s *memoryStore) Get(set, key string) ([]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	record, found := s.get(set, key)
+	if !found {
+		return nil, nil
+	}
+
+	return copyBytes(record.value), nil
+}
+
+func (s *memoryStore) GetAll(set string) (map[string][]byte, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	records := make(map[string][]byte, len(s.sets[set]))
+	for key, record := range s.sets[set] {
+		if !expiredAt(record.expiresAt) {
+			records[key] = copyBytes(record.value)
+		}
+	}
+
+	return records, nil
+}
+
+func (s *memoryStore) Set(set, key string, value []byte, ttl time.Duration) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.set(set, key, memoryRecord{value: value, expiresAt: expiryOf(ttl)})
+	return nil
+}
+
+func (s *memoryStore) SetNX(set, key string, value []byte, ttl time.Duration) (bool, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if _, found := s.get(set, key); found {
+		return false, nil
+	}
+
+	s.set(set, key, memoryRecord{value: value, expiresAt: expiryOf(ttl)})
+	return true, nil
+}
+
+func (s *memoryStore) Delete(set, key string) (bool, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	_, found := s.get(set, key)
+	delete(s.sets[set], key)
+	return found, nil
+}
+
+func (s *memoryStore) CompareAndDelete(set, key string, value []byte) (bool, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	record, found := s.get(set, key)
+	if !found || !bytes.Equal(record.value, value) {
+		return false, nil
+	}
+
+	delete(s.sets[set], key)
+	return true, nil
+}
+
+func (s *memoryStore) Incr(key string, window time.Duration) (int, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	counter, found := s.counters[key]
+	if !found || expiredAt(counter.expiresAt) {
+		counter = &memoryCounter{expiresAt: time.Now().Add(window)}
+		s.counters[key] = counter
+	}
+
+	counter.value++
+	return counter.value, nil
+}
+
+func (s *memoryStore) Hit(key string, limit RateLimit) (bool, error) {
+	if limit.Algorithm == FixedWindow {
+		count, err := s.Incr(key, limit.Window)
+		return count <= limit.Limit, err
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	state, found := s.rateLimits[key]
+	if !found || expiredAt(state.expiresAt) {
+		state = &memoryRateLimit{}
+		s.rateLimits[key] = state
+	}
+
+	now := time.Now()
+	switch limit.Algorithm {
+	case SlidingWindowLog:
+		return state.logHit(now, limit), nil
+	case SlidingWindowCounter:
+		return state.countHit(now, limit), nil
+	case TokenBucket:
+		return state.takeToken(now, limit), nil
+	default:
+		return false, unknownRateAlgorithm(limit.Algorithm)
+	}
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// Looks up a record which has not expired. The lock must be held.
+func (s *memoryStore) get(set, key string) (memoryRecord, bool) {
+	record, found := s.sets[set][key]
+	if !found || expiredAt(record.expiresAt) {
+		return memoryRecord{}, false
+	}
+
+	return record, true
+}
+
+// Stores a copy of the record, so that the caller may reuse its value. The lock must be held.
+func (s *memoryStore) set(set, key string, record memoryRecord) {
+	if s.sets[set] == nil {
+		s.sets[set] = make(map[string]memoryRecord)
+	}
+
+	record.value = copyBytes(record.value)
+	s.sets[set][key] = record
+}
+
+// Removes the expired records, counters and rate limits. Returns the number of them removed.
+func (s *memoryStore) housekeep() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	removed := 0
+	for _, records := range s.sets {
+		for key, record := range records {
+			if expiredAt(record.expiresAt) {
+				delete(records, key)
+				removed++
+			}
+		}
+	}
+
+	for key, counter := range s.counters {
+		if expiredAt(counter.expiresAt) {
+			delete(s.counters, key)
+			removed++
+		}
+	}
+
+	for key, state := range s.rateLimits {
+		if expiredAt(state.expiresAt) {
+			delete(s.rateLimits, key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Applies the SlidingWindowLog algorithm. The state expires once the last hit leaves the window.
+func (l *memoryRateLimit) logHit(now time.Time, limit RateLimit) bool {
+	start := now.Add(-limit.Window)
+	for len(l.hits) > 0 && !l.hits[0].After(start) {
+		l.hits = l.hits[1:]
+	}
+
+	if len(l.hits) >= limit.Limit {
+		return false
+	}
+
+	l.hits = append(l.hits, now)
+	l.expiresAt = now.Add(limit.Window)
+	return true
+}
+
+// Applies the SlidingWindowCounter algorithm. The state expires once the current window is
+// no longer the previous one.
+func (l *memoryRateLimit) countHit(now time.Time, limit RateLimit) bool {
+	start := now.Truncate(limit.Window)
+	if start.Equal(l.windowStart.Add(limit.Window)) {
+		l.previous, l.current = l.current, 0
+	} else if !start.Equal(l.windowStart) {
+		l.previous, l.current = 0, 0
+	}
+
+	l.windowStart = start
+	l.expiresAt = start.Add(2 * limit.Window)
+
+	// The hits of the previous window are assumed to have been evenly spread over it
+	overlap := float64(limit.Window-now.Sub(start)) / float64(limit.Window)
+	if float64(l.previous)*overlap+float64(l.current) >= float64(limit.Limit) {
+		return false
+	}
+
+	l.current++
+	return true
+}
+
+// Applies the TokenBucket algorithm. The state expires once the bucket is full again.
+func (l *memoryRateLimit) takeToken(now time.Time, limit RateLimit) bool {
+	burst := float64(limit.burst())
+	if l.updatedAt.IsZero() {
+		l.tokens = burst
+	} else if now.After(l.updatedAt) {
+		refilled := float64(now.Sub(l.updatedAt)) * float64(limit.Limit) / float64(limit.Window)
+		l.tokens = math.Min(burst, l.tokens+refilled)
+	}
+
+	taken := l.tokens >= 1
+	if taken {
+		l.tokens--
+	}
+
+	l.updatedAt = now
+	l.expiresAt = now.Add(limit.refillTime(burst - l.tokens))
+	return taken
+}
+
+// Returns a copy of the bytes, or nil if there are none
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+)
+
+// Code challenge methods defined by RFC 7636 Section 4.2 (https://tools.ietf.org/html/rfc7636#section-4.2)
+const (
+	PKCEMethodPlain = "plain"
+	PKCEMethodS256  = "S256"
+)
+
+// ValidateCodeChallenge checks the code_challenge and code_challenge_method
+// parameters of an authorization request and returns the effective method.
+// If no method is specified, it defaults to "plain" as per the RFC.
+// Refer: https://tools.ietf.org/html/rfc7636#section-4.3
+func ValidateCodeChallenge(challenge, method string) (string, error) {
+	if challenge == "" {
+		if method != "" {
+			return "", fmt.Errorf("code_challenge_method sent without a code_challenge")
+		}
+
+		return "", nil
+	}
+
+	if method == "" {
+		method = PKCEMethodPlain
+	}
+
+	if method != PKCEMethodPlain && method != PKCEMethodS256 {
+		return "", fmt.Errorf("unsupported code_challenge_method: %s", method)
+	}
+
+	// The challenge has the same syntax as the verifier in both the methods
+	// since the S256 challenge is base64url-encoded without padding.
+	if !validPKCEString(challenge) {
+		return "", fmt.Errorf("code_challenge must be 43-128 characters from [A-Z] / [a-z] / [0-9] / \"-\" / \".\" / \"_\" / \"~\"")
+	}
+
+	return method, nil
+}
+
+// Checks if the verifier transforms into the challenge using the given method.
+// Refer: https://tools.ietf.org/html/rfc7636#section-4.6
+func verifyCodeChallenge(verifier, challenge, method string) bool {
+	if !validPKCEString(verifier) {
+		return false
+	}
+
+	var derived string
+	switch method {
+	case PKCEMethodPlain, "":
+		derived = verifier
+	case PKCEMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		derived = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(derived), []byte(challenge)) == 1
+}
+
+// Checks the length and character set of code verifiers and challenges.
+// Refer: https://tools.ietf.org/html/rfc7636#section-4.1
+func validPKCEString(str string) bool {
+	if len(str) < 43 || len(str) > 128 {
+		return false
+	}
+
+	for _, c := range str {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package cache
+
+import "testing"
+
+// A code verifier and its S256 code challenge
+const (
+	testVerifier  = "dBjftJeZ4CVP-mJ92K9TeYfSzuAWvEn4kAKeqqn8L0M"
+	testChallenge = "Ri81o8dXAn3tfjpdGbGMIFpUcACRSO8ZRuknSME92qY"
+)
+
+func TestValidateCodeChallenge(t *testing.T) {
+	cases := []struct {
+		challenge, method, expected string
+		fails                       bool
+	}{
+		{"", "", "", false},
+		{"", PKCEMethodS256, "", true},
+		{testChallenge, "", PKCEMethodPlain, false},
+		{testChallenge, PKCEMethodS256, PKCEMethodS256, false},
+		{testChallenge, "S512", "", true},
+		{"tooShort", PKCEMethodPlain, "", true},
+		{testChallenge[:42] + "+", PKCEMethodPlain, "", true},
+	}
+
+	for _, c := range cases {
+		method, err := ValidateCodeChallenge(c.challenge, c.method)
+		if c.fails && err == nil {
+			t.Errorf("%q/%q: expected an error", c.challenge, c.method)
+		} else if !c.fails && (err != nil || method != c.expected) {
+			t.Errorf("%q/%q: expected %q, got %q (%v)", c.challenge, c.method, c.expected, method, err)
+		}
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	if !verifyCodeChallenge(testVerifier, testChallenge, PKCEMethodS256) {
+		t.Error("S256 verifier rejected")
+	}
+
+	if !verifyCodeChallenge(testVerifier, testVerifier, PKCEMethodPlain) {
+		t.Error("plain verifier rejected")
+	}
+
+	if verifyCodeChallenge(testVerifier, testVerifier, PKCEMethodS256) {
+		t.Error("plain verifier accepted for S256 challenge")
+	}
+
+	if verifyCodeChallenge("", "", PKCEMethodPlain) {
+		t.Error("empty verifier accepted")
+	}
+}
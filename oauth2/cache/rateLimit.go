@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// RateAlgorithm names an algorithm which decides whether a hit is within a rate limit
+type RateAlgorithm string
+
+const (
+	// FixedWindow counts the hits in consecutive windows, starting with the first hit of each window.
+	// Up to twice the limit may be let through around the end of a window.
+	FixedWindow RateAlgorithm = "fixed_window"
+
+	// SlidingWindowLog logs the time of every hit let through, and lets a hit through
+	// if fewer than the limit were logged during the window which ends with it.
+	SlidingWindowLog RateAlgorithm = "sliding_window_log"
+
+	// SlidingWindowCounter counts the hits in consecutive windows, and estimates the hits
+	// during the window which ends with a hit by weighting the count of the previous window.
+	SlidingWindowCounter RateAlgorithm = "sliding_window_counter"
+
+	// TokenBucket lets a hit through if it can take a token from a bucket holding up to the burst,
+	// which is refilled with the limit of tokens per window.
+	TokenBucket RateAlgorithm = "token_bucket"
+)
+
+// ParseRateAlgorithm returns the rate limiting algorithm with the name, or FixedWindow if it is empty
+func ParseRateAlgorithm(name string) (RateAlgorithm, error) {
+	algorithm := RateAlgorithm(name)
+	switch algorithm {
+	case "":
+		return FixedWindow, nil
+	case FixedWindow, SlidingWindowLog, SlidingWindowCounter, TokenBucket:
+		return algorithm, nil
+	default:
+		return "", unknownRateAlgorithm(algorithm)
+	}
+}
+
+// Returns the error of a store asked to apply an unknown rate limiting algorithm
+func unknownRateAlgorithm(algorithm RateAlgorithm) error {
+	return fmt.Errorf("unknown rate limiting algorithm: %s", algorithm)
+}
+
+// RateLimit describes how many hits are let through.
+//
+// Limit: the number of hits let through during a window
+// Burst: the size of the bucket of the TokenBucket algorithm, which defaults to 'Limit'
+type RateLimit struct {
+	Algorithm RateAlgorithm
+	Limit     int
+	Window    time.Duration
+	Burst     int
+}
+
+// Returns the size of the bucket of the TokenBucket algorithm
+func (l RateLimit) burst() int {
+	if l.Burst <= 0 {
+		return l.Limit
+	}
+
+	return l.Burst
+}
+
+// Returns the time taken by the TokenBucket algorithm to refill 'tokens'
+func (l RateLimit) refillTime(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(l.Window) / float64(l.Limit)))
+}
+
+// HitRateLimit registers a hit, such as a request of a client on a route, on the rate limit under 'key'.
+// Returns false if the hit exceeds the limit.
+func HitRateLimit(key string, limit RateLimit) (bool, error) {
+	if limit.Algorithm == "" {
+		limit.Algorithm = FixedWindow
+	}
+
+	// The state kept by an algorithm is not understood by the others
+	return store.Hit(string(limit.Algorithm)+":"+key, limit)
+}
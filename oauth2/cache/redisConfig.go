@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// Time allowed for establishing a connection with Redis or a Sentinel
+	redisConnectTimeout = 5 * time.Second
+
+	// Time for which a pooled connection may be idle before its health is checked on borrowing it
+	redisHealthCheckInterval = time.Minute
+
+	// Master name looked up from the Sentinels unless REDIS_SENTINEL_MASTER is set
+	defaultSentinelMaster = "mymaster"
+)
+
+// Holds how to connect to Redis.
+//
+// network, address: where the server is, unless it is discovered through the sentinels
+// options: the password, database and TLS settings of the server
+// sentinels: addresses of the Sentinels which monitor the master named 'masterName'
+// prefix: prepended to every key, so that several instances of OA2B can share a server
+// description: names the server in the logs, without its password
+type redisConfig struct {
+	network     string
+	address     string
+	options     []redis.DialOption
+	sentinels   []string
+	masterName  string
+	prefix      string
+	description string
+}
+
+// Reads the Redis configuration from the environment variables.
+//
+// If:
+// - REDIS_URL is defined, connects to the server at that URL, as described at parseRedisURL.
+// - DOCKER is defined, connects to a Redis container.
+// - REDIS_HOST, REDIS_PASS and REDIS_PORT are defined, connects to that server.
+// - none of these are defined, connects to a local Redis server.
+//
+// If REDIS_SENTINELS lists the comma-separated addresses of Sentinels, the master named by
+// REDIS_SENTINEL_MASTER is connected to instead of the host of the URL, and followed on failover.
+// REDIS_PREFIX is prepended to every key.
+func redisConfigFromEnv() (*redisConfig, error) {
+	var config *redisConfig
+	var err error
+
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		config, err = parseRedisURL(redisURL)
+		if err != nil {
+			return nil, err
+		}
+	} else if os.Getenv("DOCKER") != "" {
+		// Uses the Redis container if running within Docker
+		config = &redisConfig{network: "tcp", address: "redis:6379", description: "Docker"}
+	} else if os.Getenv("REDIS_HOST") == "" && os.Getenv("REDIS_PASS") == "" && os.Getenv("REDIS_PORT") == "" {
+		// Else defaults to a local Redis server
+		config = &redisConfig{network: "tcp", address: ":6379", description: "Local"}
+	} else {
+		config = &redisConfig{
+			network:     "tcp",
+			address:     net.JoinHostPort(os.Getenv("REDIS_HOST"), os.Getenv("REDIS_PORT")),
+			options:     []redis.DialOption{redis.DialPassword(os.Getenv("REDIS_PASS"))},
+			description: os.Getenv("REDIS_HOST"),
+		}
+	}
+
+	if sentinels := os.Getenv("REDIS_SENTINELS"); sentinels != "" {
+		config.sentinels = strings.Split(sentinels, ",")
+		config.masterName = os.Getenv("REDIS_SENTINEL_MASTER")
+		if config.masterName == "" {
+			config.masterName = defaultSentinelMaster
+		}
+
+		config.description = fmt.Sprintf("%s, through the Sentinels at %s", config.masterName, sentinels)
+	}
+
+	config.prefix = os.Getenv("REDIS_PREFIX")
+	return config, nil
+}
+
+// Parses a Redis URL of the form:
+// - redis://[:password@]host[:port][/database]
+// - rediss://[:password@]host[:port][/database], over TLS
+// - unix://[:password@]/path/to/socket[?db=database]
+func parseRedisURL(rawurl string) (*redisConfig, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &redisConfig{}
+	database := u.Query().Get("db")
+
+	switch u.Scheme {
+	case "redis", "rediss":
+		host, port := u.Hostname(), u.Port()
+		if host == "" {
+			host = "localhost"
+		}
+		if port == "" {
+			port = "6379"
+		}
+
+		config.network = "tcp"
+		config.address = net.JoinHostPort(host, port)
+		u.Host = config.address
+		config.options = append(config.options, redis.DialUseTLS(u.Scheme == "rediss"))
+
+		if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+			database = path
+		}
+	case "unix":
+		if u.Path == "" {
+			return nil, errors.New("redis URL without a socket path: " + rawurl)
+		}
+
+		config.network = "unix"
+		config.address = u.Path
+	default:
+		return nil, fmt.Errorf("invalid redis URL scheme: %s", u.Scheme)
+	}
+
+	if database != "" {
+		db, err := strconv.Atoi(database)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid redis database: %s", database)
+		}
+
+		config.options = append(config.options, redis.DialDatabase(db))
+	}
+
+	if password, ok := u.User.Password(); ok {
+		config.options = append(config.options, redis.DialPassword(password))
+	}
+
+	// The password is left out of the logs
+	u.User = nil
+	config.description = u.String()
+	return config, nil
+}
+
+// Connects to the server, or to the current master if Sentinels are configured
+func (c *redisConfig) dial() (redis.Conn, error) {
+	options := append([]redis.DialOption{redis.DialConnectTimeout(redisConnectTimeout)}, c.options...)
+	if len(c.sentinels) == 0 {
+		return redis.Dial(c.network, c.address, options...)
+	}
+
+	address, err := c.masterAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := redis.Dial("tcp", address, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The Sentinels may still name the previous master while failing over
+	err = checkRedisMaster(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &sentinelConn{Conn: conn}, nil
+}
+
+// Asks the Sentinels in turn for the address of the master, until one of them knows it.
+// Refer: https://redis.io/topics/sentinel-clients
+func (c *redisConfig) masterAddress() (string, error) {
+	var errs []string
+	for _, sentinel := range c.sentinels {
+		conn, err := redis.Dial("tcp", strings.TrimSpace(sentinel), redis.DialConnectTimeout(redisConnectTimeout))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		addr, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", c.masterName))
+		closeConn(conn)
+
+		if err == redis.ErrNil {
+			errs = append(errs, sentinel+" does not know "+c.masterName)
+		} else if err != nil {
+			errs = append(errs, err.Error())
+		} else if len(addr) != 2 {
+			errs = append(errs, "unexpected reply from "+sentinel)
+		} else {
+			return net.JoinHostPort(addr[0], addr[1]), nil
+		}
+	}
+
+	return "", fmt.Errorf("no Sentinel knows the master %s: %s", c.masterName, strings.Join(errs, "; "))
+}
+
+// Checks the health of a pooled connection which has been idle for a while.
+// Connections to a master demoted by a failover are discarded as well.
+func (c *redisConfig) testOnBorrow(conn redis.Conn, idleSince time.Time) error {
+	if time.Since(idleSince) < redisHealthCheckInterval {
+		return nil
+	}
+
+	if len(c.sentinels) > 0 {
+		return checkRedisMaster(conn)
+	}
+
+	_, err := conn.Do("PING")
+	return err
+}
+
+// Returns an error unless the connection is with a master
+func checkRedisMaster(conn redis.Conn) error {
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+
+	if len(role) == 0 {
+		return errors.New("empty reply to ROLE")
+	}
+
+	name, err := redis.String(role[0], nil)
+	if err != nil {
+		return err
+	} else if name != "master" {
+		return errors.New("redis server is a " + name + ", not a master")
+	}
+
+	return nil
+}
+
+// A connection with the master discovered through the Sentinels.
+// Once the server replies that it is no longer a master, or that it lost its link with the master,
+// the connection is broken so that the pool discards it and dials the current master instead.
+// A busy pool would otherwise keep using it, since its connections are only checked after being idle.
+// Refer: https://redis.io/topics/sentinel-clients
+type sentinelConn struct {
+	redis.Conn
+	err error
+}
+
+func (c *sentinelConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	return reply, c.check(err)
+}
+
+func (c *sentinelConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	return reply, c.check(err)
+}
+
+func (c *sentinelConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Conn.Err()
+}
+
+// Breaks the connection if the error is a READONLY or MASTERDOWN reply, which is returned as
+// a connection error rather than a reply, so that the store is considered unavailable.
+// Scripts report the reply to the commands they call within their own error.
+func (c *sentinelConn) check(err error) error {
+	reply, ok := err.(redis.Error)
+	if !ok {
+		return err
+	}
+
+	for _, code := range []string{"READONLY", "MASTERDOWN"} {
+		if strings.HasPrefix(string(reply), code+" ") || strings.Contains(string(reply), "-"+code+" ") {
+			c.err = errors.New("redis server is no longer a master: " + string(reply))
+			return c.err
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestParseRedisURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		network     string
+		address     string
+		description string
+	}{
+		{"redis://localhost", "tcp", "localhost:6379", "redis://localhost:6379"},
+		{"redis://:secret@redis.example.com:6380/2", "tcp", "redis.example.com:6380", "redis://redis.example.com:6380/2"},
+		{"rediss://redis.example.com", "tcp", "redis.example.com:6379", "rediss://redis.example.com:6379"},
+		{"redis://", "tcp", "localhost:6379", "redis://localhost:6379"},
+		{"unix:///var/run/redis.sock?db=1", "unix", "/var/run/redis.sock", "unix:///var/run/redis.sock?db=1"},
+	}
+
+	for _, test := range tests {
+		config, err := parseRedisURL(test.url)
+		if err != nil {
+			t.Errorf("%s: %s", test.url, err)
+			continue
+		}
+
+		if config.network != test.network || config.address != test.address || config.description != test.description {
+			t.Errorf("%s: parsed as %s %s (%s)", test.url, config.network, config.address, config.description)
+		}
+	}
+
+	for _, invalid := range []string{"http://localhost", "redis://localhost/db", "redis://localhost/-1", "unix://"} {
+		_, err := parseRedisURL(invalid)
+		if err == nil {
+			t.Errorf("%s: accepted", invalid)
+		}
+	}
+}
+
+// Runs against the local Redis server, if there is one
+func TestRedisStorePrefix(t *testing.T) {
+	conn, err := redis.Dial("tcp", ":6379", redis.DialConnectTimeout(time.Second))
+	if err != nil {
+		t.Skip("Redis is not available: " + err.Error())
+	}
+	defer closeConn(conn)
+
+	s := openRedisStore(&redisConfig{network: "tcp", address: ":6379", prefix: "OA2B_Test*:", description: "Local"})
+	defer s.Close()
+
+	err = s.Set("tokens", "key", []byte("value"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete("tokens", "key")
+
+	value, err := redis.String(conn.Do("GET", "OA2B_Test*:tokens:key"))
+	if err != nil || value != "value" {
+		t.Fatalf("Record not stored under the prefix: %q, %v", value, err)
+	}
+
+	records, err := s.GetAll("tokens")
+	if err != nil || len(records) != 1 || string(records["key"]) != "value" {
+		t.Fatalf("Unexpected records: %q, %v", records, err)
+	}
+
+	// Stores with other prefixes do not see the record
+	other := openRedisStore(&redisConfig{network: "tcp", address: ":6379", prefix: "OA2B_Test:", description: "Local"})
+	defer other.Close()
+
+	records, err = other.GetAll("tokens")
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Record of another prefix returned: %q, %v", records, err)
+	}
+}
+
+// TestRedisSentinel checks that the master is discovered through the Sentinels,
+// and that a server which is no longer a master is not connected to.
+func TestRedisSentinel(t *testing.T) {
+	server := newFakeRedisServer(t)
+	defer server.Close()
+
+	config := &redisConfig{
+		sentinels:  []string{"127.0.0.1:1", server.Addr().String()},
+		masterName: "mymaster",
+	}
+
+	conn, err := config.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = config.testOnBorrow(conn, time.Now().Add(-2*redisHealthCheckInterval))
+	if err != nil {
+		t.Fatalf("Connection with the master failed the health check: %v", err)
+	}
+
+	server.role.Store("slave")
+	err = config.testOnBorrow(conn, time.Now().Add(-2*redisHealthCheckInterval))
+	if err == nil {
+		t.Fatal("Connection with a demoted master passed the health check")
+	}
+	conn.Close()
+
+	_, err = config.dial()
+	if err == nil {
+		t.Fatal("Connected to a server which is not a master")
+	}
+
+	config.masterName = "unknown"
+	_, err = config.dial()
+	if err == nil || !strings.Contains(err.Error(), "does not know unknown") {
+		t.Fatalf("Unexpected error for an unknown master: %v", err)
+	}
+}
+
+// TestRedisSentinelFailover checks that a pooled connection with a master demoted by a failover
+// is discarded as soon as a write is refused, rather than once it has been idle for a while.
+func TestRedisSentinelFailover(t *testing.T) {
+	server := newFakeRedisServer(t)
+	defer server.Close()
+
+	s := openRedisStore(&redisConfig{sentinels: []string{server.Addr().String()}, masterName: "mymaster"})
+	defer s.Close()
+
+	err := s.Set("tokens", "key", []byte("value"), time.Minute)
+	if err != nil || s.pool.IdleCount() != 1 {
+		t.Fatalf("Record not stored with the master: %v", err)
+	}
+
+	server.role.Store("slave")
+	err = s.Set("tokens", "key", []byte("value"), time.Minute)
+	if err == nil || !s.unavailable(err) {
+		t.Fatalf("Write refused by a demoted master not taken for unavailability: %v", err)
+	}
+
+	if s.pool.IdleCount() != 0 {
+		t.Fatal("Connection with a demoted master returned to the pool")
+	}
+
+	// The master is dialed again once the failover is over
+	server.role.Store("master")
+	err = s.Set("tokens", "key", []byte("value"), time.Minute)
+	if err != nil {
+		t.Fatalf("Record not stored with the new master: %v", err)
+	}
+}
+
+// Serves the commands used to discover and check a master, acting as both the Sentinel and the master
+type fakeRedisServer struct {
+	net.Listener
+	role atomic.Value
+}
+
+func newFakeRedisServer(t *testing.T) *fakeRedisServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeRedisServer{Listener: listener}
+	server.role.Store("master")
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeRedisServer) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		args, err := readFakeRedisCommand(reader)
+		if err != nil {
+			return
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "SENTINEL":
+			if args[2] != "mymaster" {
+				fmt.Fprint(conn, "*-1\r\n")
+				continue
+			}
+
+			host, port, _ := net.SplitHostPort(s.Addr().String())
+			fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		case "ROLE":
+			role := s.role.Load().(string)
+			fmt.Fprintf(conn, "*1\r\n$%d\r\n%s\r\n", len(role), role)
+		case "SET":
+			if s.role.Load().(string) != "master" {
+				fmt.Fprint(conn, "-READONLY You can't write against a read only replica.\r\n")
+				continue
+			}
+
+			fmt.Fprint(conn, "+OK\r\n")
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+	}
+}
+
+// Reads a command sent as an array of bulk strings
+func readFakeRedisCommand(reader *bufio.Reader) ([]string, error) {
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		return strings.TrimSuffix(line, "\r\n"), err
+	}
+
+	line, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimPrefix(line, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		_, err = readLine() // Length of the bulk string
+		if err != nil {
+			return nil, err
+		}
+
+		args[i], err = readLine()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
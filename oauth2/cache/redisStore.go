@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Stores every record under its own key, which is the name of its set followed by
+// a colon and the key of the record, and lets Redis expire it as per its TTL.
+// Counters are stored under their key as is. Every key starts with the configured prefix.
+type redisStore struct {
+	pool   *redis.Pool
+	prefix string
+}
+
+// Number of keys requested per SCAN when the records of a set are listed
+const redisScanCount = 1000
+
+// Escapes the characters of a key which SCAN would otherwise take for a glob pattern
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// Removes a record if it still holds the value passed as ARGV[1].
+// Returns 1 if the record was removed, 0 otherwise.
+var compareAndDeleteScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Increments a counter and sets its TTL in milliseconds when it is created
+var incrScript = redis.NewScript(1, `
+local value = redis.call("INCR", KEYS[1])
+if value == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return value
+`)
+
+// Applies the SlidingWindowLog algorithm to the sorted set of the hits let through, scored by their time.
+// ARGV: the time of the hit and the window in milliseconds, the limit, and a member naming the hit.
+// Returns 1 if the hit was let through, 0 otherwise.
+var slidingWindowLogScript = redis.NewScript(1, `
+local now, window = tonumber(ARGV[1]), tonumber(ARGV[2])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[3]) then
+	return 0
+end
+
+redis.call("ZADD", KEYS[1], now, ARGV[4])
+redis.call("PEXPIRE", KEYS[1], window)
+return 1
+`)
+
+// Applies the SlidingWindowCounter algorithm to a hash holding the start of the current window
+// and the hits counted during it and during the previous one.
+// ARGV: the time of the hit and the window in milliseconds, and the limit.
+// Returns 1 if the hit was let through, 0 otherwise.
+var slidingWindowCounterScript = redis.NewScript(1, `
+local now, window = tonumber(ARGV[1]), tonumber(ARGV[2])
+local start = now - now % window
+local state = redis.call("HMGET", KEYS[1], "start", "current", "previous")
+local current, previous = 0, 0
+if tonumber(state[1]) == start then
+	current, previous = tonumber(state[2]), tonumber(state[3])
+elseif tonumber(state[1]) == start - window then
+	previous = tonumber(state[2])
+end
+
+local allowed = 0
+if previous * (window - (now - start)) / window + current < tonumber(ARGV[3]) then
+	current = current + 1
+	allowed = 1
+end
+
+redis.call("HMSET", KEYS[1], "start", start, "current", current, "previous", previous)
+redis.call("PEXPIRE", KEYS[1], start + 2 * window - now)
+return allowed
+`)
+
+// Applies the TokenBucket algorithm to a hash holding the tokens left in the bucket and the time
+// at which it was last updated.
+// ARGV: the time of the hit and the window in milliseconds, the limit, and the burst.
+// Returns 1 if the hit was let through, 0 otherwise.
+var tokenBucketScript = redis.NewScript(1, `
+local now, window, limit, burst = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens, updated = tonumber(state[1]), tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+elseif now > updated then
+	tokens = math.min(burst, tokens + (now - updated) * limit / window)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tokens, "updated", math.max(now, updated or now))
+redis.call("PEXPIRE", KEYS[1], math.max(1, math.ceil((burst - tokens) * window / limit)))
+return allowed
+`)
+
+// Opens a pool of connections with the Redis server configured by the environment
+// variables described at redisConfigFromEnv. Connections are established on demand,
+// hence a server which cannot be reached is reported by the operations of the store.
+func newRedisStore() (*redisStore, error) {
+	config, err := redisConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return openRedisStore(config), nil
+}
+
+// Opens a pool of connections with the Redis server described by the config
+func openRedisStore(config *redisConfig) *redisStore {
+	log.Println("Redis Server: " + config.description)
+	return &redisStore{
+		prefix: config.prefix,
+		pool: &redis.Pool{
+			MaxActive:    30,
+			MaxIdle:      10,
+			Dial:         config.dial,
+			TestOnBorrow: config.testOnBorrow,
+		},
+	}
+}
+
+func (s *redisStore) Get(set, key string) ([]byte, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	value, err := redis.Bytes(conn.Do("GET", s.redisKey(set, key)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+// The keys of the set are listed with SCAN, so that Redis is not blocked
+// while doing so, and fetched with MGET. Records which expire in between are left out.
+func (s *redisStore) GetAll(set string) (map[string][]byte, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	prefix := s.redisKey(set, "")
+	records := make(map[string][]byte)
+	cursor := 0
+
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", redisGlobEscaper.Replace(prefix)+"*", "COUNT", redisScanCount))
+		if err != nil {
+			return nil, err
+		}
+
+		var keys []string
+		_, err = redis.Scan(reply, &cursor, &keys)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) > 0 {
+			args := make([]interface{}, len(keys))
+			for i, key := range keys {
+				args[i] = key
+			}
+
+			values, err := redis.ByteSlices(conn.Do("MGET", args...))
+			if err != nil {
+				return nil, err
+			}
+
+			for i, value := range values {
+				if value != nil {
+					records[keys[i][len(prefix):]] = value
+				}
+			}
+		}
+
+		if cursor == 0 {
+			return records, nil
+		}
+	}
+}
+
+func (s *redisStore) Set(set, key string, value []byte, ttl time.Duration) error {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	// A record which has already expired replaces the previous value by removing it
+	if ttl < 0 {
+		_, err := conn.Do("DEL", s.redisKey(set, key))
+		return err
+	}
+
+	_, err := conn.Do("SET", s.redisSetArgs(set, key, value, ttl)...)
+	return err
+}
+
+func (s *redisStore) SetNX(set, key string, value []byte, ttl time.Duration) (bool, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	// A record which has already expired is stored by dropping it, unless there is one with the same key
+	if ttl < 0 {
+		exists, err := redis.Bool(conn.Do("EXISTS", s.redisKey(set, key)))
+		return !exists, err
+	}
+
+	reply, err := redis.String(conn.Do("SET", append(s.redisSetArgs(set, key, value, ttl), "NX")...))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+
+	return reply == "OK", err
+}
+
+func (s *redisStore) Delete(set, key string) (bool, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	return redis.Bool(conn.Do("DEL", s.redisKey(set, key)))
+}
+
+func (s *redisStore) CompareAndDelete(set, key string, value []byte) (bool, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	return redis.Bool(compareAndDeleteScript.Do(conn, s.redisKey(set, key), value))
+}
+
+func (s *redisStore) Incr(key string, window time.Duration) (int, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	return redis.Int(incrScript.Do(conn, s.prefix+key, window.Milliseconds()))
+}
+
+// The hits are timed by OA2B, hence the replicas sharing a rate limit should have synchronized clocks
+func (s *redisStore) Hit(key string, limit RateLimit) (bool, error) {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	key = s.prefix + key
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	window := limit.Window.Milliseconds()
+
+	switch limit.Algorithm {
+	case FixedWindow:
+		count, err := redis.Int(incrScript.Do(conn, key, window))
+		return count <= limit.Limit, err
+	case SlidingWindowLog:
+		return redis.Bool(slidingWindowLogScript.Do(conn, key, now, window, limit.Limit, generateNonce(8)))
+	case SlidingWindowCounter:
+		return redis.Bool(slidingWindowCounterScript.Do(conn, key, now, window, limit.Limit))
+	case TokenBucket:
+		return redis.Bool(tokenBucketScript.Do(conn, key, now, window, limit.Limit, limit.burst()))
+	default:
+		return false, unknownRateAlgorithm(limit.Algorithm)
+	}
+}
+
+func (s *redisStore) Close() error {
+	return s.pool.Close()
+}
+
+func (s *redisStore) ping() error {
+	conn := s.pool.Get()
+	defer closeConn(conn)
+
+	_, err := conn.Do("PING")
+	return err
+}
+
+// Errors replied by Redis and the pool running out of connections do not mean that Redis is unavailable,
+// except for the replies of a demoted master, which sentinelConn turns into connection errors
+func (s *redisStore) unavailable(err error) bool {
+	_, replied := err.(redis.Error)
+	return !replied && err != redis.ErrPoolExhausted
+}
+
+// Returns the Redis key of a record
+func (s *redisStore) redisKey(set, key string) string {
+	return s.prefix + set + ":" + key
+}
+
+// Returns the arguments of the SET command which stores a record with the TTL
+func (s *redisStore) redisSetArgs(set, key string, value []byte, ttl time.Duration) []interface{} {
+	args := []interface{}{s.redisKey(set, key), value}
+	if ttl == NoExpiry {
+		return args
+	}
+
+	// Redis expects at least a millisecond
+	milliseconds := ttl.Milliseconds()
+	if milliseconds < 1 {
+		milliseconds = 1
+	}
+
+	return append(args, "PX", milliseconds)
+}
+
+// Closes a Redis connection.
+// Also captures the error, if any, and logs it.
+func closeConn(conn redis.Conn) {
+	err := conn.Close()
+	if err != nil {
+		log.Println(err)
+	}
+}
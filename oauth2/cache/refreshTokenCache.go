@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// Set which holds the refresh tokens that were replaced by rotation
+const rotatedRefreshTokensSet = "OA2B_RotatedRefreshTokens"
+
+// Returns the set which indexes the refresh tokens of the tokens set to the access tokens issued with them
+func refreshTokenIndexSet(tokensSet string) string {
+	return tokensSet + "_RefreshTokens"
+}
+
+// Returns the set which indexes the token families of the tokens set to their latest access tokens
+func tokenFamilyIndexSet(tokensSet string) string {
+	return tokensSet + "_Families"
+}
+
+// ErrRefreshTokenReused is returned when a refresh token which was replaced by rotation is presented again.
+// The token family has been revoked by then.
+var ErrRefreshTokenReused = errors.New("refresh token was already used, all tokens issued with it have been revoked")
+
+// Holds the state shared by the tokens descending from the same authorization through refresh requests.
+// It is part of the metadata of the tokens of the flows issuing refresh tokens.
+//
+// FamilyID: identifies the family, so that it can be revoked as a whole
+// FamilyCreationTime: the time of the original authorization, from which the absolute lifetime is counted
+// RefreshScope: the scope of the refresh token if it differs from that of the access token
+type refreshFamily struct {
+	FamilyID           string    `json:"family_id,omitempty"`
+	FamilyCreationTime time.Time `json:"family_creation_time"`
+	RefreshScope       string    `json:"refresh_scope,omitempty"`
+}
+
+// Holds a refresh token which was replaced by rotation along with its family
+type rotatedRefreshToken struct {
+	FamilyID  string    `json:"family_id"`
+	ClientID  string    `json:"client_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Starts a new family if the token is not part of one yet, i.e., if it was issued on an authorization.
+func (f *refreshFamily) init(creationTime time.Time) {
+	if f.FamilyID == "" {
+		f.FamilyID = hash(creationTime.String() + generateNonce(32))
+		f.FamilyCreationTime = creationTime
+	}
+}
+
+// Returns the time at which a refresh token issued at 'issued' expires.
+// It expires once it has been idle for its lifetime, or once the family reaches its absolute lifetime.
+func (f refreshFamily) refreshExpiry(issued time.Time, lifetimes config.TokenLifetimes) time.Time {
+	expiry := issued.Add(time.Duration(lifetimes.RefreshTokenSeconds()) * time.Second)
+	if lifetimes.RefreshTokenAbsolute > 0 && !f.FamilyCreationTime.IsZero() {
+		absolute := f.FamilyCreationTime.Add(time.Duration(lifetimes.RefreshTokenAbsolute) * time.Second)
+		if absolute.Before(expiry) {
+			expiry = absolute
+		}
+	}
+
+	return expiry
+}
+
+// Indexes the refresh token and the family of an access token in 'tokensSet', so that
+// they can be looked up by key. The index records are retained for as long as the token.
+// Only the latest access token of a family is indexed, since every refresh invalidates the previous one.
+func indexRefreshToken(tokensSet, accessToken, refreshToken, familyID string, retention time.Duration) error {
+	err := store.Set(refreshTokenIndexSet(tokensSet), refreshToken, []byte(accessToken), retention)
+	if err != nil {
+		return err
+	}
+
+	return store.Set(tokenFamilyIndexSet(tokensSet), familyID, []byte(accessToken), retention)
+}
+
+// Returns the access token in 'tokensSet' which was issued with the refresh token, or "" if there is none.
+// The access token may have been invalidated since.
+func lookupRefreshToken(tokensSet, refreshToken string) (string, error) {
+	accessToken, err := store.Get(refreshTokenIndexSet(tokensSet), refreshToken)
+	return string(accessToken), err
+}
+
+// Removes the refresh token from the index before it is exchanged for a new token.
+// Of several concurrent refresh requests, only one removes it and may proceed.
+func consumeRefreshToken(tokensSet, refreshToken, accessToken string) (bool, error) {
+	return store.CompareAndDelete(refreshTokenIndexSet(tokensSet), refreshToken, []byte(accessToken))
+}
+
+// Removes the index records of the refresh tokens and token families whose access tokens
+// were invalidated, since they are otherwise retained for as long as the tokens would have been.
+// Returns the number of records removed.
+func sweepRefreshTokenIndexes() (int, error) {
+	removed := 0
+	for _, tokensSet := range []string{authCodeTokensSet, ropcTokensSet} {
+		for _, indexSet := range []string{refreshTokenIndexSet(tokensSet), tokenFamilyIndexSet(tokensSet)} {
+			records, err := store.GetAll(indexSet)
+			if err != nil {
+				return removed, err
+			}
+
+			for key, accessToken := range records {
+				token, err := store.Get(tokensSet, string(accessToken))
+				if err != nil {
+					return removed, err
+				} else if token != nil {
+					continue
+				}
+
+				// A refresh request may have indexed a new access token meanwhile
+				deleted, err := store.CompareAndDelete(indexSet, key, accessToken)
+				if err != nil {
+					return removed, err
+				} else if deleted {
+					removed++
+				}
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// Remembers a refresh token replaced by rotation until it would have expired, so that it is recognized if it is reused.
+// Refer: https://datatracker.ietf.org/doc/html/draft-ietf-oauth-security-topics#section-4.14.2
+func markRefreshTokenRotated(refreshToken string, rotated rotatedRefreshToken) error {
+	jsonBytes, err := json.Marshal(rotated)
+	if err != nil {
+		panic(err)
+	}
+
+	return store.Set(rotatedRefreshTokensSet, refreshToken, jsonBytes, time.Until(rotated.ExpiresAt))
+}
+
+// Checks if a refresh token which was not found had been replaced by rotation.
+// If it had been, the reuse suggests that it was stolen, hence every token of its family
+// in 'tokensSet' is revoked and ErrRefreshTokenReused is returned. Else, ErrInvalidRefreshToken is returned.
+// Refer: https://datatracker.ietf.org/doc/html/draft-ietf-oauth-security-topics#section-4.14.2
+func detectRefreshTokenReuse(tokensSet, refreshToken, clientID string) error {
+	jsonBytes, err := store.Get(rotatedRefreshTokensSet, refreshToken)
+	if err != nil {
+		return err
+	} else if jsonBytes == nil {
+		return ErrInvalidRefreshToken
+	}
+
+	var rotated rotatedRefreshToken
+	err = json.Unmarshal(jsonBytes, &rotated)
+	if err != nil {
+		return err
+	}
+
+	if rotated.ClientID != clientID || time.Now().After(rotated.ExpiresAt) {
+		return ErrInvalidRefreshToken
+	}
+
+	log.Printf("Refresh token reused by %s, revoking its family\n", clientID)
+	err = revokeTokenFamily(tokensSet, rotated.FamilyID)
+	if err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// Invalidates every token of the family in the tokens set.
+// Returns ErrStoreDegraded while the store is degraded.
+func revokeTokenFamily(tokensSet, familyID string) error {
+	err := checkStoreDegraded()
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := store.Get(tokenFamilyIndexSet(tokensSet), familyID)
+	if err != nil || accessToken == nil {
+		return err
+	}
+
+	_, err = store.Delete(tokensSet, string(accessToken))
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Delete(tokenFamilyIndexSet(tokensSet), familyID)
+	return err
+}
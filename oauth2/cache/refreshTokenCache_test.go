@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestRefreshTokenRotation checks that a new refresh token is issued on every refresh, and
+// that the whole family is revoked once a refresh token replaced by rotation is reused
+func TestRefreshTokenRotation(t *testing.T) {
+	token, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewROPCRefreshToken(token.RefreshToken, "clientID", "", true)
+	if err != nil {
+		t.Fatal(err)
+	} else if rotated.RefreshToken == token.RefreshToken {
+		t.Fatal("Refresh token not rotated")
+	}
+
+	rotatedAgain, err := NewROPCRefreshToken(rotated.RefreshToken, "clientID", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reused by another client, which does not revoke the family
+	_, err = NewROPCRefreshToken(token.RefreshToken, "otherClientID", "", true)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("Unexpected error on reuse by another client: %v", err)
+	}
+
+	_, err = NewROPCRefreshToken(token.RefreshToken, "clientID", "", true)
+	if err != ErrRefreshTokenReused {
+		t.Errorf("Reuse of a rotated refresh token not detected: %v", err)
+	}
+
+	if VerifyROPCToken(rotatedAgain.AccessToken) {
+		t.Error("Access token of the family not revoked")
+	}
+
+	_, err = NewROPCRefreshToken(rotatedAgain.RefreshToken, "clientID", "", true)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh token of the family not revoked: %v", err)
+	}
+}
+
+func TestRefreshExpiry(t *testing.T) {
+	now := time.Now()
+	family := refreshFamily{FamilyID: "family", FamilyCreationTime: now.Add(-50 * time.Second)}
+
+	// Idle lifetime
+	expiry := family.refreshExpiry(now, config.TokenLifetimes{RefreshToken: 30})
+	if !expiry.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("Unexpected idle expiry: %v", expiry.Sub(now))
+	}
+
+	// Absolute lifetime counted from the original authorization
+	expiry = family.refreshExpiry(now, config.TokenLifetimes{RefreshToken: 30, RefreshTokenAbsolute: 60})
+	if !expiry.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("Unexpected absolute expiry: %v", expiry.Sub(now))
+	}
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// RevokeToken invalidates a token issued by any of the flows to the given client.
+// The hint, if any, decides whether the token is first looked up as an access or
+// a refresh token. The search is extended to the other kind if it isn't found.
+// Revoking a refresh token also revokes the access tokens issued with it.
+// Tokens issued to other clients are left intact.
+// Returns true if a token was revoked, or ErrStoreDegraded while the store is degraded.
+// Refer: https://tools.ietf.org/html/rfc7009#section-2.1
+func RevokeToken(token, tokenTypeHint, clientID string) (bool, error) {
+	err := checkStoreDegraded()
+	if err != nil {
+		return false, err
+	}
+
+	revokeAccess := func() (bool, error) {
+		switch {
+		case strings.HasPrefix(token, AuthCodeFlowID):
+			t, err := getAuthCodeToken(token)
+			if t == nil || err != nil || t.Meta.ClientID != clientID {
+				return false, err
+			}
+			invalidateAuthCodeToken(token)
+		case strings.HasPrefix(token, ImplicitFlowID):
+			t, err := getImplicitToken(token)
+			if t == nil || err != nil || t.Meta.ClientID != clientID {
+				return false, err
+			}
+			invalidateImplicitToken(token)
+		case strings.HasPrefix(token, ROPCFlowID):
+			t, err := getROPCToken(token)
+			if t == nil || err != nil || t.Meta.ClientID != clientID {
+				return false, err
+			}
+			invalidateROPCToken(token)
+		case strings.HasPrefix(token, ClientCredsFlowID):
+			t, err := getClientCredsToken(token)
+			if t == nil || err != nil || t.Meta.ClientID != clientID {
+				return false, err
+			}
+			invalidateClientCredsToken(token)
+		case strings.HasPrefix(token, DeviceFlowID):
+			t, err := getDeviceToken(token)
+			if t == nil || err != nil || t.Meta.ClientID != clientID {
+				return false, err
+			}
+			invalidateDeviceToken(token)
+		default:
+			return false, nil
+		}
+
+		return true, nil
+	}
+
+	revokeRefresh := func() (bool, error) {
+		switch {
+		case strings.HasPrefix(token, AuthCodeFlowID):
+			return revokeAuthCodeRefreshToken(token, clientID)
+		case strings.HasPrefix(token, ROPCFlowID):
+			return revokeROPCRefreshToken(token, clientID)
+		}
+
+		return false, nil
+	}
+
+	if tokenTypeHint == RefreshTokenHint {
+		revoked, err := revokeRefresh()
+		if revoked || err != nil {
+			return revoked, err
+		}
+
+		return revokeAccess()
+	}
+
+	revoked, err := revokeAccess()
+	if revoked || err != nil {
+		return revoked, err
+	}
+
+	return revokeRefresh()
+}
+
+// Invalidates every token issued to the client by any of the flows, along with its refresh token.
+// Returns ErrStoreDegraded while the store is degraded, since the tokens issued before would not be found.
+// Refer: https://tools.ietf.org/html/rfc7592#section-2.3
+func revokeClientTokens(clientID string) error {
+	err := checkStoreDegraded()
+	if err != nil {
+		return err
+	}
+
+	for _, tokensSet := range []string{authCodeTokensSet, implicitTokensSet, ropcTokensSet, clientCredsTokensSet, deviceTokensSet} {
+		records, err := store.GetAll(tokensSet)
+		if err != nil {
+			return err
+		}
+
+		for accessToken, jsonBytes := range records {
+			// The metadata of the tokens of every flow names the client
+			var token struct {
+				Meta struct {
+					ClientID string `json:"client_id"`
+				} `json:"meta"`
+			}
+
+			if json.Unmarshal(jsonBytes, &token) != nil || token.Meta.ClientID != clientID {
+				continue
+			}
+
+			_, err = store.Delete(tokensSet, accessToken)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
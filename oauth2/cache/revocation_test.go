@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestRevokeAccessToken checks that an access token can only be revoked by its client
+func TestRevokeAccessToken(t *testing.T) {
+	token, err := NewClientCredsToken("clientID", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := RevokeToken(token.AccessToken, "", "otherClientID")
+	if err != nil || revoked {
+		t.Fatalf("Token revoked by another client: %v", err)
+	}
+
+	revoked, err = RevokeToken(token.AccessToken, RefreshTokenHint, "clientID")
+	if err != nil || !revoked {
+		t.Fatalf("Token not revoked: %v", err)
+	}
+
+	if VerifyClientCredsToken(token.AccessToken) {
+		t.Fatal("Revoked token still exists")
+	}
+}
+
+// TestRevokeRefreshToken checks that revoking a refresh token
+// also revokes the access tokens issued with it
+func TestRevokeRefreshToken(t *testing.T) {
+	token, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err = NewROPCRefreshToken(token.RefreshToken, "clientID", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := RevokeToken(token.RefreshToken, RefreshTokenHint, "clientID")
+	if err != nil || !revoked {
+		t.Fatalf("Refresh token not revoked: %v", err)
+	}
+
+	if VerifyROPCToken(token.AccessToken) {
+		t.Fatal("Access token survived the revocation of its refresh token")
+	}
+
+	if ROPCRefreshTokenExists(token.RefreshToken, false) {
+		t.Fatal("Revoked refresh token still exists")
+	}
+}
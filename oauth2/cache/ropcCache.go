@@ -6,11 +6,11 @@ import (
 	"log"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 const (
-	// Redis HSET which holds the issued tokens
+	// Set which holds the issued tokens
 	ropcTokensSet = "OA2B_ROPC_Tokens"
 
 	// ROPCFlowID is prepended to access and refresh tokens issued by the ROPC flow
@@ -21,18 +21,26 @@ const (
 // https://tools.ietf.org/html/rfc6749#section-4.3.3
 type ROPCToken struct {
 	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
 }
 
 // Holds the meta data of an access token
 type ropcTokenMeta struct {
-	CreationTime time.Time `json:"creation_time"`
-	Nonce        string    `json:"nonce"`
+	ClientID               string    `json:"client_id"`
+	Subject                string    `json:"subject,omitempty"`
+	Scope                  string    `json:"scope,omitempty"`
+	CreationTime           time.Time `json:"creation_time"`
+	Nonce                  string    `json:"nonce"`
+	RefreshExpiresIn       int       `json:"refresh_expires_in,omitempty"`
+	RefreshAbsoluteExpires int       `json:"refresh_absolute_expires_in,omitempty"`
+	refreshFamily
 }
 
 // Holds the token as well as its metadata.
-// It is the internal representation of the token inside the Redis cache.
+// It is the internal representation of the token inside the cache.
 type internalROPCToken struct {
 	Token ROPCToken     `json:"token"`
 	Meta  ropcTokenMeta `json:"meta"`
@@ -40,19 +48,30 @@ type internalROPCToken struct {
 
 // NewROPCToken issues new access and refresh tokens for the ROPC flow.
 // It generates and stores a token and stores it along with its meta data
-// in the Redis cache.
-func NewROPCToken(refreshToken string) (*ROPCToken, error) {
-	conn := NewConn()
-	defer CloseConn(conn)
+// in the cache. The tokens expire as per the lifetimes of the client.
+func NewROPCToken(clientID, subject, scope, refreshToken string, lifetimes config.TokenLifetimes) (*ROPCToken, error) {
+	return newROPCToken(clientID, subject, scope, refreshToken, lifetimes, refreshFamily{})
+}
 
+// Issues the tokens as part of the family, which is started if it is empty
+func newROPCToken(clientID, subject, scope, refreshToken string, lifetimes config.TokenLifetimes, family refreshFamily) (*ROPCToken, error) {
 	var token *ROPCToken
 	var meta *ropcTokenMeta
-	var err error
-	reply := 1
+	var internal internalROPCToken
+	stored := false
 
 	// Generates a new key if a duplicate is encountered
-	for reply == 1 {
+	for !stored {
 		token, meta = generateROPCToken()
+		token.ExpiresIn = lifetimes.AccessTokenSeconds()
+		token.Scope = scope
+		meta.ClientID = clientID
+		meta.Subject = subject
+		meta.Scope = scope
+		meta.RefreshExpiresIn = lifetimes.RefreshTokenSeconds()
+		meta.RefreshAbsoluteExpires = lifetimes.RefreshTokenAbsolute
+		meta.refreshFamily = family
+		meta.refreshFamily.init(meta.CreationTime)
 
 		// Replace newly generated refresh token with function parameter 'refreshToken'
 		// if it is of length 72 since SHA-256 generates a string of length 64 and we
@@ -61,20 +80,22 @@ func NewROPCToken(refreshToken string) (*ROPCToken, error) {
 			token.RefreshToken = refreshToken
 		}
 
-		reply, err = redis.Int(conn.Do("HEXISTS", ropcTokensSet, token.AccessToken))
+		internal = internalROPCToken{Token: *token, Meta: *meta}
+		jsonBytes, err := json.Marshal(internal)
+		if err != nil {
+			panic(err)
+		}
+
+		stored, err = store.SetNX(ropcTokensSet, token.AccessToken, jsonBytes, internal.retention())
 		if err != nil {
 			log.Println(err)
 			return nil, err
 		}
 	}
 
-	jsonBytes, err := json.Marshal(internalROPCToken{Token: *token, Meta: *meta})
-	if err != nil {
-		panic(err)
-	}
-
-	_, err = conn.Do("HSET", ropcTokensSet, token.AccessToken, string(jsonBytes))
+	err := indexRefreshToken(ropcTokensSet, token.AccessToken, token.RefreshToken, meta.FamilyID, internal.retention())
 	if err != nil {
+		log.Println(err)
 		return nil, err
 	}
 
@@ -82,64 +103,193 @@ func NewROPCToken(refreshToken string) (*ROPCToken, error) {
 }
 
 // NewROPCRefreshToken returns new token for the previously issued refresh token
-// The refresh token is kept intact and can be used for future requests.
-func NewROPCRefreshToken(refreshToken string) (*ROPCToken, error) {
-	token, err := NewROPCToken(refreshToken)
+// The previously issued access token is invalidated.
+// If 'rotate' is false, the refresh token is kept intact and can be used for future requests.
+// Else, a new refresh token is issued and the previous one must not be used again.
+// The new token may be issued with a narrower 'scope' than was granted, which defaults to the granted scope.
+// Returns ErrInvalidRefreshToken if the refresh token is not found or was issued to another client,
+// ErrRefreshTokenReused if it was replaced by rotation and ErrInvalidScope if the scope exceeds the granted scope.
+// Refer: https://tools.ietf.org/html/rfc6749#section-6
+func NewROPCRefreshToken(refreshToken, clientID, scope string, rotate bool) (*ROPCToken, error) {
+	prev, err := findROPCRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	} else if prev == nil {
+		return nil, detectRefreshTokenReuse(ropcTokensSet, refreshToken, clientID)
+	} else if prev.Meta.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	family := prev.Meta.refreshFamily
+	family.RefreshScope = prev.refreshScope()
+	scope, err = narrowScope(family.RefreshScope, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	consumed, err := consumeRefreshToken(ropcTokensSet, refreshToken, prev.Token.AccessToken)
+	if err != nil {
+		return nil, err
+	} else if !consumed {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	invalidateROPCToken(prev.Token.AccessToken)
+
+	// A new refresh token is generated unless the previous one is passed on
+	nextRefreshToken := refreshToken
+	if rotate {
+		nextRefreshToken = ""
+	}
+
+	token, err := newROPCToken(prev.Meta.ClientID, prev.Meta.Subject, scope, nextRefreshToken, prev.lifetimes(), family)
 	if err != nil {
 		return nil, err
 	}
 
+	if rotate {
+		err = markRefreshTokenRotated(refreshToken, rotatedRefreshToken{
+			FamilyID:  family.FamilyID,
+			ClientID:  clientID,
+			ExpiresAt: prev.refreshExpiry(),
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
 	return token, nil
 }
 
-// ROPCRefreshTokenExists checks if the refresh token exists in the Redis cache
+// ROPCRefreshTokenExists checks if the refresh token exists in the cache
 // and returns the appropriate boolean value.
 // Params:
 // refreshToken: the token to look for in the cache
 // invalidateIfFound: if true, the token is invalidated if found
 func ROPCRefreshTokenExists(refreshToken string, invalidateIfFound bool) bool {
-	conn := NewConn()
-	defer CloseConn(conn)
-
-	var token internalROPCToken
-	items, err := redis.ByteSlices(conn.Do("HGETALL", ropcTokensSet))
+	token, err := findROPCRefreshToken(refreshToken)
 	if err != nil {
 		log.Println(err)
 	}
 
-	for i := 1; i < len(items); i += 2 {
-		err := json.Unmarshal(items[i], &token)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-
-		if refreshToken == token.Token.RefreshToken {
-			if invalidateIfFound {
-				invalidateROPCToken(token.Token.AccessToken)
-			}
+	if token == nil {
+		return false
+	}
 
-			return true
-		}
+	if invalidateIfFound {
+		invalidateROPCToken(token.Token.AccessToken)
 	}
 
-	return false
+	return true
 }
 
-// VerifyROPCToken checks if the token exists in the Redis cache.
+// VerifyROPCToken checks if the token exists in the cache.
 // Returns true if token found, false otherwise.
 func VerifyROPCToken(token string) bool {
-	conn := NewConn()
-	defer CloseConn(conn)
+	jsonBytes, err := store.Get(ropcTokensSet, token)
+	return err == nil && jsonBytes != nil
+}
+
+// Looks up an access token in the cache.
+// Returns nil if the token was not found.
+func getROPCToken(accessToken string) (*internalROPCToken, error) {
+	jsonBytes, err := store.Get(ropcTokensSet, accessToken)
+	if err != nil || jsonBytes == nil {
+		return nil, err
+	}
 
-	_, err := redis.String(conn.Do("HGET", ropcTokensSet, token))
-	return err == nil
+	var token internalROPCToken
+	err = json.Unmarshal(jsonBytes, &token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// Looks up the token which holds the refresh token through the refresh token index.
+// Returns nil if the refresh token was not found.
+func findROPCRefreshToken(refreshToken string) (*internalROPCToken, error) {
+	accessToken, err := lookupRefreshToken(ropcTokensSet, refreshToken)
+	if err != nil || accessToken == "" {
+		return nil, err
+	}
+
+	token, err := getROPCToken(accessToken)
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	if refreshToken != token.Token.RefreshToken || time.Now().After(token.refreshExpiry()) {
+		return nil, nil
+	}
+
+	return token, nil
+}
+
+// Invalidates the access token issued to the client along with the refresh token.
+// Returns true if the refresh token was found.
+func revokeROPCRefreshToken(refreshToken, clientID string) (bool, error) {
+	token, err := findROPCRefreshToken(refreshToken)
+	if err != nil || token == nil || token.Meta.ClientID != clientID {
+		return false, err
+	}
+
+	return store.Delete(ropcTokensSet, token.Token.AccessToken)
+}
+
+// Describes the token as per RFC 7662.
+func (t *internalROPCToken) info(refresh bool) *TokenInfo {
+	info := &TokenInfo{
+		Active:   true,
+		Scope:    t.Meta.Scope,
+		ClientID: t.Meta.ClientID,
+		Iat:      t.Meta.CreationTime.Unix(),
+		Subject:  t.Meta.Subject,
+		Flow:     "password",
+	}
+
+	if refresh {
+		info.Exp = t.refreshExpiry().Unix()
+	} else {
+		info.TokenType = "bearer"
+		info.Exp = t.Meta.CreationTime.Add(time.Duration(t.Token.ExpiresIn) * time.Second).Unix()
+	}
+
+	return info
+}
+
+// Returns the lifetimes the token was issued with.
+// Tokens issued without a refresh token lifetime share it with the access token.
+func (t *internalROPCToken) lifetimes() config.TokenLifetimes {
+	return config.TokenLifetimes{
+		AccessToken:          t.Token.ExpiresIn,
+		RefreshToken:         t.Meta.RefreshExpiresIn,
+		RefreshTokenAbsolute: t.Meta.RefreshAbsoluteExpires,
+	}
+}
+
+// Returns the time at which the refresh token expires
+func (t *internalROPCToken) refreshExpiry() time.Time {
+	return t.Meta.refreshExpiry(t.Meta.CreationTime, t.lifetimes())
+}
+
+// Returns the time for which the token is retained, i.e., for as long as its refresh token is valid
+func (t *internalROPCToken) retention() time.Duration {
+	return retention(t.Meta.CreationTime, t.Token.ExpiresIn, t.refreshExpiry())
+}
+
+// Returns the scope granted to the refresh token, which the access token may have narrowed
+func (t *internalROPCToken) refreshScope() string {
+	if t.Meta.RefreshScope != "" {
+		return t.Meta.RefreshScope
+	}
+
+	return t.Meta.Scope
 }
 
 func invalidateROPCToken(accessToken string) {
-	conn := NewConn()
-	defer CloseConn(conn)
-	_, err := conn.Do("HDEL", ropcTokensSet, accessToken)
+	_, err := store.Delete(ropcTokensSet, accessToken)
 	if err != nil {
 		log.Println(err)
 	}
@@ -159,40 +309,12 @@ func generateROPCToken() (*ROPCToken, *ropcTokenMeta) {
 	refreshToken := ROPCFlowID + hash(fmt.Sprintf("%s%s%s", accessToken, creationTime, nonce))
 
 	return &ROPCToken{
-			AccessToken:  accessToken,
-			RefreshToken: refreshToken,
-			ExpiresIn:    3600,
-		}, &ropcTokenMeta{
-			CreationTime: creationTime,
-			Nonce:        nonce,
-		}
-}
-
-// Housekeeping service for the ROPC tokens set
-func ropcTokenHousekeep(conn redis.Conn) {
-	var token internalROPCToken
-	var err error
-	var diff time.Duration
-
-	items, err := redis.ByteSlices(conn.Do("HGETALL", ropcTokensSet))
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	for i := 1; i < len(items); i += 2 {
-		err = json.Unmarshal(items[i], &token)
-		if err != nil {
-			log.Println(err)
-			break
-		}
-
-		diff = time.Now().Sub(token.Meta.CreationTime)
-		if diff >= time.Hour {
-			_, err = conn.Do("HDEL", ropcTokensSet, items[i-1])
-			if err != nil {
-				log.Println(err)
-			}
-		}
+		AccessToken:  accessToken,
+		TokenType:    "bearer",
+		RefreshToken: refreshToken,
+		ExpiresIn:    3600,
+	}, &ropcTokenMeta{
+		CreationTime: creationTime,
+		Nonce:        nonce,
 	}
 }
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 )
 
 // TestROPCFlow tests the entirety of the functions set of ropcStore
@@ -9,7 +11,7 @@ import (
 func TestROPCFlow(t *testing.T) {
 	// Generating a token based on the grant which would
 	// be generated by invoking the token endpoint
-	token, err := NewROPCToken("")
+	token, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{})
 	if err != nil {
 		t.Fatalf("Could not generate token:\n%s\n", err)
 	}
@@ -23,7 +25,7 @@ func TestROPCFlow(t *testing.T) {
 	}
 
 	// Issue new token based on the previously issued refresh token
-	token, err = NewROPCRefreshToken(token.RefreshToken)
+	token, err = NewROPCRefreshToken(token.RefreshToken, "clientID", "", false)
 	if err != nil {
 		t.Fatalf("Could not generate token from refresh token\n")
 	}
@@ -39,3 +41,107 @@ func TestROPCRefreshTokenExists(t *testing.T) {
 		t.Fatalf("Empty refresh token should not exist")
 	}
 }
+
+// TestROPCTokenLifetimes checks that the tokens expire as per the lifetimes of the client
+func TestROPCTokenLifetimes(t *testing.T) {
+	token, err := NewROPCToken("clientID", "oa2buser", "", "", config.TokenLifetimes{AccessToken: 60, RefreshToken: 120})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.ExpiresIn != 60 {
+		t.Errorf("Unexpected expires_in: %d", token.ExpiresIn)
+	}
+
+	info, err := IntrospectToken(token.RefreshToken, RefreshTokenHint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !info.Active || info.Exp-info.Iat != 120 {
+		t.Errorf("Unexpected refresh token lifetime: %+v", info)
+	}
+
+	_, err = NewROPCRefreshToken(token.RefreshToken, "otherClientID", "", false)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("Refresh token used by another client: %v", err)
+	}
+
+	refreshed, err := NewROPCRefreshToken(token.RefreshToken, "clientID", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed.ExpiresIn != 60 {
+		t.Errorf("Lifetime not retained on refresh: %d", refreshed.ExpiresIn)
+	}
+
+	invalidateROPCToken(refreshed.AccessToken)
+}
+
+// TestROPCRefreshScope checks that refresh requests may narrow the granted scope but not widen it
+func TestROPCRefreshScope(t *testing.T) {
+	token, err := NewROPCToken("clientID", "oa2buser", "read write", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	narrowed, err := NewROPCRefreshToken(token.RefreshToken, "clientID", "read", false)
+	if err != nil {
+		t.Fatal(err)
+	} else if narrowed.Scope != "read" {
+		t.Errorf("Scope not narrowed: %s", narrowed.Scope)
+	}
+
+	_, err = NewROPCRefreshToken(token.RefreshToken, "clientID", "read admin", false)
+	if err != ErrInvalidScope {
+		t.Errorf("Scope widened on refresh: %v", err)
+	}
+
+	if !VerifyROPCToken(narrowed.AccessToken) {
+		t.Error("Access token invalidated by a rejected refresh request")
+	}
+
+	// The narrowed access token does not narrow the refresh token
+	restored, err := NewROPCRefreshToken(token.RefreshToken, "clientID", "", false)
+	if err != nil {
+		t.Fatal(err)
+	} else if restored.Scope != "read write" {
+		t.Errorf("Granted scope not restored: %s", restored.Scope)
+	}
+
+	invalidateROPCToken(restored.AccessToken)
+}
+
+// BenchmarkROPCRefreshToken measures a refresh request while the cache holds
+// a growing number of live tokens. The refresh token is looked up through
+// its index, hence the cost must not grow with the number of live tokens.
+func BenchmarkROPCRefreshToken(b *testing.B) {
+	lifetimes := config.TokenLifetimes{AccessToken: 60}
+	issue := func() (string, error) {
+		token, err := NewROPCToken("clientID", "oa2buser", "", "", lifetimes)
+		if err != nil {
+			return "", err
+		}
+
+		return token.AccessToken, nil
+	}
+
+	benchmarkLiveTokens(b, issue, invalidateROPCToken, func(b *testing.B) {
+		token, err := NewROPCToken("clientID", "oa2buser", "", "", lifetimes)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			token, err = NewROPCRefreshToken(token.RefreshToken, "clientID", "", false)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		invalidateROPCToken(token.AccessToken)
+	})
+}
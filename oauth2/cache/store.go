@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// Store is a storage backend of the cache.
+// Records are grouped in sets, such as the tokens issued by a flow,
+// and looked up by their key within the set.
+//
+// Records are stored with a TTL, after which the store removes them. Stores which cannot
+// expire records by themselves may return them until the housekeeping service removes them.
+type Store interface {
+	// Get returns the value of the record, or nil if it was not found.
+	Get(set, key string) ([]byte, error)
+
+	// GetAll returns every record of the set, mapped by their keys.
+	GetAll(set string) (map[string][]byte, error)
+
+	// Set stores the record, replacing its previous value if any.
+	Set(set, key string, value []byte, ttl time.Duration) error
+
+	// SetNX stores the record unless there is one with the same key.
+	// Returns true if the record was stored.
+	SetNX(set, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Delete removes the record. Returns true if it was found.
+	Delete(set, key string) (bool, error)
+
+	// CompareAndDelete removes the record if it still holds 'value'. Returns true if it was removed.
+	// Of several concurrent calls for the same record, only one removes it.
+	CompareAndDelete(set, key string, value []byte) (bool, error)
+
+	// Incr increments a counter and returns its new value.
+	// A counter expires 'window' after it was created, after which it starts from zero again.
+	Incr(key string, window time.Duration) (int, error)
+
+	// Hit registers a hit on the rate limit under 'key', as per the algorithm of the limit.
+	// Returns false if the hit exceeds the limit. Concurrent hits are counted one after the other.
+	Hit(key string, limit RateLimit) (bool, error)
+
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// NoExpiry is the TTL of records which are kept until they are deleted
+const NoExpiry time.Duration = 0
+
+// Returns the expiry of a record stored now with the TTL, or the zero time if it does not expire
+func expiryOf(ttl time.Duration) time.Time {
+	if ttl == NoExpiry {
+		return time.Time{}
+	}
+
+	return time.Now().Add(ttl)
+}
+
+// Checks if a record which expires at 'expiresAt' has expired.
+// Records with the zero expiry do not expire.
+func expiredAt(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+// Names of the storage backends accepted by OpenStore
+const (
+	RedisStore  = "redis"
+	MemoryStore = "memory"
+	FileStore   = "file"
+)
+
+// FailurePolicy decides how a component behaves while the storage backend is unavailable
+type FailurePolicy string
+
+const (
+	// FailOpen keeps serving the requests, with a degraded service
+	FailOpen FailurePolicy = "open"
+
+	// FailClosed fails the requests which need the storage backend
+	FailClosed FailurePolicy = "closed"
+)
+
+// ParseFailurePolicy returns the failure policy with the name, which is either open or closed
+func ParseFailurePolicy(name string) (FailurePolicy, error) {
+	policy := FailurePolicy(name)
+	if policy != FailOpen && policy != FailClosed {
+		return "", fmt.Errorf("unknown failure policy: %s", name)
+	}
+
+	return policy, nil
+}
+
+// The storage backend of the cache. The in-memory backend is used
+// until another one is opened, which lets tests run without Redis.
+var store Store = newMemoryStore()
+
+// The name and failure policy of the storage backend
+var storeName, storeFailure = MemoryStore, FailOpen
+
+// OpenStore replaces the storage backend with the named one and starts the housekeeping service.
+// It must be called before the cache is used.
+//
+// redis: Redis, as configured by the environment variables described at redisConfigFromEnv
+// memory: an in-process store whose records are lost when the server stops
+// file: an in-process store which persists the records to the file at 'path'
+//
+// If Redis becomes unavailable, the records are kept in memory until it is back as per
+// the FailOpen policy, while the operations of the cache fail as per the FailClosed policy.
+func OpenStore(name, path string, failure FailurePolicy) error {
+	switch name {
+	case RedisStore:
+		redisStore, err := newRedisStore()
+		if err != nil {
+			return err
+		}
+
+		store = redisStore
+		if failure == FailOpen {
+			store = newFallbackStore(redisStore)
+		}
+	case MemoryStore:
+		store = newMemoryStore()
+	case FileStore:
+		fileStore, err := openFileStore(path)
+		if err != nil {
+			return err
+		}
+
+		store = fileStore
+	default:
+		return fmt.Errorf("unknown store: %s", name)
+	}
+
+	storeName, storeFailure = name, failure
+	log.Printf("Store: %s, fail %s\n", name, failure)
+	startHousekeeping()
+	return nil
+}
+
+// CloseStore closes the storage backend.
+// Also captures the error, if any, and logs it.
+func CloseStore() {
+	utils.Clearln() // Remove the '^C' generated by SIGINT
+	log.Println("Closing store")
+	err := store.Close()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	log.Println("Store closed")
+}
+
+// Health states of the storage backend
+const (
+	StoreOK          = "ok"
+	StoreDegraded    = "degraded"
+	StoreUnavailable = "unavailable"
+)
+
+// StoreHealth describes the state of the storage backend.
+//
+// Status: StoreOK, StoreDegraded while the records are kept in memory, or StoreUnavailable
+// DegradedSince: the time since which the storage backend is degraded
+// Error: the error which made the storage backend degraded or unavailable
+type StoreHealth struct {
+	Backend       string        `json:"backend"`
+	Status        string        `json:"status"`
+	Failure       FailurePolicy `json:"failure"`
+	DegradedSince *time.Time    `json:"degraded_since,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// CheckStore checks if the storage backend can be reached and describes its state
+func CheckStore() StoreHealth {
+	health := StoreHealth{Backend: storeName, Status: StoreOK, Failure: storeFailure}
+
+	pinger, ok := store.(interface{ ping() error })
+	if !ok {
+		return health
+	}
+
+	// Pinging a fallback store which cannot reach its primary store degrades it
+	err := pinger.ping()
+	if err != nil {
+		health.Status = StoreUnavailable
+		health.Error = err.Error()
+	}
+
+	if fallback, ok := store.(*fallbackStore); ok {
+		since, err := fallback.degraded()
+		if !since.IsZero() {
+			health.Status = StoreDegraded
+			health.DegradedSince = &since
+			if err != nil {
+				health.Error = err.Error()
+			}
+		}
+	}
+
+	return health
+}
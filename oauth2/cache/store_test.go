@@ -0,0 +1,352 @@
+package cache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := newMemoryStore()
+	testStore(t, s)
+	testExpiry(t, s)
+	testRateLimits(t, s)
+}
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oa2b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := openFileStore(filepath.Join(dir, "oa2b.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	testStore(t, s)
+	testExpiry(t, s)
+	testRateLimits(t, s)
+}
+
+// TestFileStorePersistence checks that records survive reopening the store,
+// while deleted and expired ones are reclaimed by compaction.
+func TestFileStorePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oa2b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "oa2b.db")
+	s, err := openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Set("tokens", "live", []byte("live"), time.Hour)
+	s.Set("tokens", "expiring", []byte("expiring"), 50*time.Millisecond)
+	s.Set("clients", "client", []byte("client"), NoExpiry)
+	for i := 0; i < compactionMinEntries; i++ {
+		s.Set("tokens", "deleted", []byte("deleted"), time.Hour)
+		s.Delete("tokens", "deleted")
+	}
+
+	// An entry cut short by a crash must not prevent the others from being loaded
+	s.file.WriteString(`{"op":"set","set":"tokens","key":"partial"`)
+	s.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	s, err = openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRecords := func() {
+		tokens, _ := s.GetAll("tokens")
+		clients, _ := s.GetAll("clients")
+		if len(tokens) != 1 || string(tokens["live"]) != "live" || string(clients["client"]) != "client" {
+			t.Fatalf("Unexpected records: %q, %q", tokens, clients)
+		}
+	}
+
+	checkRecords()
+
+	s.housekeep()
+	s.compactIfObsolete()
+	if s.entries != 2 {
+		t.Fatalf("File not compacted, %d entries", s.entries)
+	}
+
+	// Records written after the compaction are appended to the compacted file
+	s.Set("tokens", "later", []byte("later"), time.Hour)
+	s.Close()
+
+	s, err = openFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	later, err := s.Get("tokens", "later")
+	if err != nil || string(later) != "later" {
+		t.Fatalf("Record written after compaction lost: %q, %v", later, err)
+	}
+
+	s.Delete("tokens", "later")
+	checkRecords()
+}
+
+// Runs against the local Redis server, if there is one
+func TestRedisStore(t *testing.T) {
+	conn, err := redis.Dial("tcp", ":6379", redis.DialConnectTimeout(time.Second))
+	if err != nil {
+		t.Skip("Redis is not available: " + err.Error())
+	}
+	closeConn(conn)
+
+	s, err := newRedisStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, s)
+	testExpiry(t, s)
+	testRateLimits(t, s)
+}
+
+// Runs 'bench' while the cache holds 1k, 10k and 100k live tokens, issued by 'issue' and
+// invalidated by 'invalidate' once done. Runs against the local Redis server if there is one,
+// and the in-memory store otherwise.
+func benchmarkLiveTokens(b *testing.B, issue func() (string, error), invalidate func(string), bench func(b *testing.B)) {
+	previous := store
+	defer func() { store = previous }()
+
+	store = newMemoryStore()
+	conn, err := redis.Dial("tcp", ":6379", redis.DialConnectTimeout(time.Second))
+	if err == nil {
+		closeConn(conn)
+		store, err = newRedisStore()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Logf("Store: %T", store)
+	issued := []string{}
+	defer func() {
+		for _, token := range issued {
+			invalidate(token)
+		}
+	}()
+
+	for _, live := range []int{1000, 10000, 100000} {
+		for len(issued) < live {
+			token, err := issue()
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			issued = append(issued, token)
+		}
+
+		b.Run(fmt.Sprintf("live=%d", live), bench)
+	}
+}
+
+// Checks the behaviour every storage backend must have
+func testStore(t *testing.T, s Store) {
+	const set = "OA2B_StoreTest"
+	defer s.Delete(set, "key")
+
+	value, err := s.Get(set, "key")
+	if err != nil || value != nil {
+		t.Fatalf("Unknown record found: %q, %v", value, err)
+	}
+
+	stored, err := s.SetNX(set, "key", []byte("first"), time.Minute)
+	if err != nil || !stored {
+		t.Fatalf("Record not stored: %v", err)
+	}
+
+	stored, err = s.SetNX(set, "key", []byte("second"), time.Minute)
+	if err != nil || stored {
+		t.Fatalf("Existing record replaced: %v", err)
+	}
+
+	err = s.Set(set, "key", []byte("third"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := s.GetAll(set)
+	if err != nil || len(records) != 1 || string(records["key"]) != "third" {
+		t.Fatalf("Unexpected records: %q, %v", records, err)
+	}
+
+	deleted, err := s.CompareAndDelete(set, "key", []byte("first"))
+	if err != nil || deleted {
+		t.Fatalf("Record deleted for a stale value: %v", err)
+	}
+
+	// Only one of the concurrent calls may delete the record
+	deletions := make(chan bool, 10)
+	wg := sync.WaitGroup{}
+	for i := 0; i < cap(deletions); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deleted, err := s.CompareAndDelete(set, "key", []byte("third"))
+			if err != nil {
+				t.Error(err)
+			}
+			deletions <- deleted
+		}()
+	}
+
+	wg.Wait()
+	close(deletions)
+
+	count := 0
+	for deleted := range deletions {
+		if deleted {
+			count++
+		}
+	}
+
+	if count != 1 {
+		t.Fatalf("Record deleted %d times", count)
+	}
+
+	deleted, err = s.Delete(set, "key")
+	if err != nil || deleted {
+		t.Fatalf("Deleted record found: %v", err)
+	}
+
+	key := "OA2B_StoreTestCounter:" + generateNonce(8)
+	for i := 1; i <= 3; i++ {
+		value, err := s.Incr(key, 100*time.Millisecond)
+		if err != nil || value != i {
+			t.Fatalf("Counter at %d, expected %d: %v", value, i, err)
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	count, err = s.Incr(key, 100*time.Millisecond)
+	if err != nil || count != 1 {
+		t.Fatalf("Counter did not expire: %d, %v", count, err)
+	}
+}
+
+// Checks that every rate limiting algorithm lets through up to the limit, even when hit concurrently,
+// and lets more through once time has passed
+func testRateLimits(t *testing.T, s Store) {
+	algorithms := []RateAlgorithm{FixedWindow, SlidingWindowLog, SlidingWindowCounter, TokenBucket}
+
+	for _, algorithm := range algorithms {
+		key := "OA2B_StoreTestRateLimit:" + generateNonce(8)
+		limit := RateLimit{Algorithm: algorithm, Limit: 5, Window: time.Minute}
+
+		allowed := make(chan bool, 20)
+		wg := sync.WaitGroup{}
+		for i := 0; i < cap(allowed); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				hit, err := s.Hit(key, limit)
+				if err != nil {
+					t.Error(err)
+				}
+				allowed <- hit
+			}()
+		}
+
+		wg.Wait()
+		close(allowed)
+
+		count := 0
+		for hit := range allowed {
+			if hit {
+				count++
+			}
+		}
+
+		if count != limit.Limit {
+			t.Errorf("%s: %d concurrent hits let through, expected %d", algorithm, count, limit.Limit)
+		}
+	}
+
+	// The hits are made at the start of a window, so that they are not split between two windows
+	const window = 200 * time.Millisecond
+	time.Sleep(time.Until(time.Now().Truncate(window).Add(window)))
+
+	limits := map[RateAlgorithm]RateLimit{}
+	keys := map[RateAlgorithm]string{}
+	for _, algorithm := range algorithms {
+		limits[algorithm] = RateLimit{Algorithm: algorithm, Limit: 3, Window: window}
+		keys[algorithm] = "OA2B_StoreTestRateLimit:" + generateNonce(8)
+	}
+
+	// The bucket holds 3 tokens, and is refilled with a token every 200ms
+	limits[TokenBucket] = RateLimit{Algorithm: TokenBucket, Limit: 1, Window: window, Burst: 3}
+
+	for _, algorithm := range algorithms {
+		for i := 1; i <= 4; i++ {
+			hit, err := s.Hit(keys[algorithm], limits[algorithm])
+			if err != nil || hit != (i <= 3) {
+				t.Fatalf("%s: hit %d let through: %v, %v", algorithm, i, hit, err)
+			}
+		}
+	}
+
+	// The sliding window counter still weighs the hits in during the following window
+	time.Sleep(2*window + 50*time.Millisecond)
+
+	for _, algorithm := range algorithms {
+		hit, err := s.Hit(keys[algorithm], limits[algorithm])
+		if err != nil || !hit {
+			t.Errorf("%s: hit not let through once the window passed: %v", algorithm, err)
+		}
+	}
+
+	_, err := s.Hit("key", RateLimit{Algorithm: "unknown", Limit: 1, Window: time.Minute})
+	if err == nil {
+		t.Error("Unknown algorithm applied")
+	}
+}
+
+// Checks that expired records are not returned
+func testExpiry(t *testing.T, s Store) {
+	const set = "OA2B_StoreTest"
+	s.Set(set, "expiring", []byte("expiring"), 50*time.Millisecond)
+	s.Set(set, "expired", []byte("expired"), -time.Second)
+
+	value, err := s.Get(set, "expiring")
+	if err != nil || string(value) != "expiring" {
+		t.Fatalf("Record expired early: %q, %v", value, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	records, err := s.GetAll(set)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("Expired records returned: %q, %v", records, err)
+	}
+
+	stored, err := s.SetNX(set, "expiring", []byte("replaced"), time.Minute)
+	if err != nil || !stored {
+		t.Fatalf("Expired record not replaced: %v", err)
+	}
+
+	s.Delete(set, "expiring")
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"net"
+	"net/url"
+)
+
+// Client authentication methods at the token endpoint
+// Refer: https://tools.ietf.org/html/rfc7591#section-2
+const (
+	AuthMethodNone        = "none"
+	AuthMethodSecretBasic = "client_secret_basic"
+	AuthMethodSecretPost  = "client_secret_post"
+)
+
+// Default lifetime of access tokens in seconds
+const defaultAccessTokenLifetime = 3600
+
+// TokenLifetimes defines the lifetimes of the tokens issued to a client in seconds
+//
+// AccessToken: defaults to an hour
+// RefreshToken: the idle lifetime of refresh tokens, counted from when they were issued or last used.
+// Defaults to the lifetime of the access token.
+// RefreshTokenAbsolute: the lifetime of refresh tokens counted from the original authorization,
+// regardless of refreshes and rotations. Unlimited if not set.
+type TokenLifetimes struct {
+	AccessToken          int `json:"accessTokenLifetime,omitempty"`
+	RefreshToken         int `json:"refreshTokenLifetime,omitempty"`
+	RefreshTokenAbsolute int `json:"refreshTokenAbsoluteLifetime,omitempty"`
+}
+
+// AccessTokenSeconds returns the lifetime of access tokens
+func (l TokenLifetimes) AccessTokenSeconds() int {
+	if l.AccessToken <= 0 {
+		return defaultAccessTokenLifetime
+	}
+
+	return l.AccessToken
+}
+
+// RefreshTokenSeconds returns the lifetime of refresh tokens
+func (l TokenLifetimes) RefreshTokenSeconds() int {
+	if l.RefreshToken <= 0 {
+		return l.AccessTokenSeconds()
+	}
+
+	return l.RefreshToken
+}
+
+// Client defines an OAuth 2.0 client along with its metadata
+//
+// RedirectURIs: the redirect URIs of the client, required for the redirect-based flows
+// GrantTypes: the grant types the client may use, refresh_token included
+// Scope: space-separated scopes the client may request, any scope if empty
+// TokenEndpointAuthMethod: one of none, client_secret_basic or client_secret_post
+// RotateRefreshTokens: if true, a new refresh token is issued on every refresh
+// RequirePKCE: if true, authorization requests without a PKCE code_challenge are rejected
+type Client struct {
+	ClientID                string   `json:"clientID"`
+	ClientSecret            string   `json:"clientSecret,omitempty"`
+	ClientName              string   `json:"clientName,omitempty"`
+	RedirectURIs            []string `json:"redirectURIs,omitempty"`
+	GrantTypes              []string `json:"grantTypes,omitempty"`
+	ResponseTypes           []string `json:"responseTypes,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	TokenEndpointAuthMethod string   `json:"tokenEndpointAuthMethod,omitempty"`
+	RotateRefreshTokens     bool     `json:"rotateRefreshTokens,omitempty"`
+	RequirePKCE             bool     `json:"requirePKCE,omitempty"`
+	TokenLifetimes
+}
+
+// IsPublic returns true if the client cannot hold a secret, which is
+// the case for clients without a secret unless an authentication method is set.
+// Refer: https://tools.ietf.org/html/rfc6749#section-2.1
+func (c Client) IsPublic() bool {
+	return c.TokenEndpointAuthMethod == AuthMethodNone ||
+		(c.TokenEndpointAuthMethod == "" && c.ClientSecret == "")
+}
+
+// AllowsGrantType checks if the client may use the grant type
+func (c Client) AllowsGrantType(grantType string) bool {
+	for _, allowed := range c.GrantTypes {
+		if allowed == grantType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowsRedirectURI checks if the redirect URI is registered for the client.
+// The URIs must match exactly, except for the port of loopback redirect URIs.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.1.2.3
+func (c Client) AllowsRedirectURI(redirectURI string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == redirectURI || matchesLoopback(registered, redirectURI) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Native apps listening on the loopback interface get a port from the OS at runtime,
+// thus any port is allowed for http redirect URIs on a loopback IP address.
+// Refer: https://tools.ietf.org/html/rfc8252#section-7.3
+func matchesLoopback(registered, redirectURI string) bool {
+	regURL, err := url.Parse(registered)
+	if err != nil || regURL.Scheme != "http" || !isLoopbackIP(regURL.Hostname()) {
+		return false
+	}
+
+	reqURL, err := url.Parse(redirectURI)
+	if err != nil || reqURL.Scheme != "http" || reqURL.Hostname() != regURL.Hostname() {
+		return false
+	}
+
+	regURL.Host, reqURL.Host = regURL.Hostname(), reqURL.Hostname()
+	return regURL.String() == reqURL.String()
+}
+
+// Checks if the host is a loopback IP literal.
+// The name localhost is not considered since it may resolve to other interfaces.
+// Refer: https://tools.ietf.org/html/rfc8252#section-8.3
+func isLoopbackIP(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// AllowsScope checks if every space-separated value of the scope
+// was registered for the client. Any scope is allowed if none were registered.
+func (c Client) AllowsScope(scope string) bool {
+	return c.Scope == "" || ScopeIncludes(c.Scope, scope)
+}
@@ -0,0 +1,94 @@
+package config
+
+import "testing"
+
+func TestClientAllows(t *testing.T) {
+	client := Client{
+		RedirectURIs: []string{"https://client.example.org/callback"},
+		GrantTypes:   []string{"authorization_code", "refresh_token"},
+		Scope:        "openid profile",
+	}
+
+	if !client.AllowsGrantType("refresh_token") || client.AllowsGrantType("password") {
+		t.Error("Unexpected grant types allowed")
+	}
+
+	if !client.AllowsRedirectURI("https://client.example.org/callback") || client.AllowsRedirectURI("https://client.example.org/") {
+		t.Error("Unexpected redirect URIs allowed")
+	}
+
+	if !client.AllowsScope("profile  openid") || !client.AllowsScope("") || client.AllowsScope("openid email") {
+		t.Error("Unexpected scopes allowed")
+	}
+
+	client.Scope = ""
+	if !client.AllowsScope("email") {
+		t.Error("Scope rejected for client without registered scopes")
+	}
+
+	client.RedirectURIs = nil
+	if client.AllowsRedirectURI("https://client.example.org/callback") || client.AllowsRedirectURI("") {
+		t.Error("Redirect URI allowed for client without registered redirect URIs")
+	}
+}
+
+func TestClientAllowsLoopbackRedirectURI(t *testing.T) {
+	client := Client{RedirectURIs: []string{"http://127.0.0.1/callback", "http://[::1]:8080/cb", "http://localhost/callback"}}
+
+	cases := []struct {
+		redirectURI string
+		expected    bool
+	}{
+		{"http://127.0.0.1/callback", true},
+		{"http://127.0.0.1:51004/callback", true},
+		{"http://[::1]:9999/cb", true},
+		{"http://[::1]/cb", true},
+		{"http://127.0.0.1:51004/other", false},
+		{"http://127.0.0.1:51004/callback?x=1", false},
+		{"https://127.0.0.1:51004/callback", false},
+		{"http://127.0.0.2:51004/callback", false},
+		{"http://localhost:51004/callback", false},
+		{"http://localhost/callback", true},
+	}
+
+	for _, c := range cases {
+		if client.AllowsRedirectURI(c.redirectURI) != c.expected {
+			t.Errorf("AllowsRedirectURI(%q): expected %v", c.redirectURI, c.expected)
+		}
+	}
+}
+
+func TestClientIsPublic(t *testing.T) {
+	cases := []struct {
+		client   Client
+		expected bool
+	}{
+		{Client{ClientSecret: "secret"}, false},
+		{Client{}, true},
+		{Client{TokenEndpointAuthMethod: AuthMethodNone}, true},
+		{Client{TokenEndpointAuthMethod: AuthMethodSecretBasic}, false},
+	}
+
+	for _, c := range cases {
+		if c.client.IsPublic() != c.expected {
+			t.Errorf("IsPublic() of %+v: expected %v", c.client, c.expected)
+		}
+	}
+}
+
+func TestTokenLifetimes(t *testing.T) {
+	var lifetimes TokenLifetimes
+	if lifetimes.AccessTokenSeconds() != 3600 || lifetimes.RefreshTokenSeconds() != 3600 {
+		t.Errorf("Unexpected default lifetimes: %d, %d", lifetimes.AccessTokenSeconds(), lifetimes.RefreshTokenSeconds())
+	}
+
+	lifetimes = TokenLifetimes{AccessToken: 300}
+	if lifetimes.AccessTokenSeconds() != 300 || lifetimes.RefreshTokenSeconds() != 300 {
+		t.Errorf("Unexpected lifetimes: %d, %d", lifetimes.AccessTokenSeconds(), lifetimes.RefreshTokenSeconds())
+	}
+
+	lifetimes.RefreshToken = 86400
+	if lifetimes.RefreshTokenSeconds() != 86400 {
+		t.Errorf("Unexpected refresh token lifetime: %d", lifetimes.RefreshTokenSeconds())
+	}
+}
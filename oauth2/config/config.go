@@ -6,38 +6,244 @@ const (
 	Implicit    = 2
 	ROPC        = 3
 	ClientCreds = 4
+	Device      = 5
 )
 
+// DeviceCodeGrantType is the grant type of the Device Authorization Grant flow
+// Refer: https://tools.ietf.org/html/rfc8628#section-3.4
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Access token formats
+const (
+	TokenFormatOpaque = "opaque"
+	TokenFormatJWT    = "jwt"
+)
+
+// AccessTokenConfig defines the format of the access tokens issued by a flow
+//
+// Format: "opaque" (default) or "jwt" for JWT access tokens as per RFC 9068
+// Alg: the algorithm used for signing JWT access tokens, RS256 (default), ES256, EdDSA or HS256
+// Audience: the aud claim of JWT access tokens, defaults to the base URL
+type AccessTokenConfig struct {
+	Format   string `json:"format"`
+	Alg      string `json:"alg"`
+	Audience string `json:"audience"`
+}
+
+// IsJWT returns true if the access tokens are issued as JWTs
+func (c AccessTokenConfig) IsJWT() bool {
+	return c.Format == TokenFormatJWT
+}
+
+// SigningAlg returns the algorithm used for signing JWT access tokens
+func (c AccessTokenConfig) SigningAlg() string {
+	if c.Alg == "" {
+		return "RS256"
+	}
+
+	return c.Alg
+}
+
+// KeysConfig defines the keys used for signing JWTs
+//
+// Files: paths of PEM-encoded RSA, EC (P-256) or Ed25519 private keys. Keys for algorithms without a file are generated at startup.
+// HMACSecret: the HS256 secret, at least 32 bytes long. Generated at startup if absent.
+// RotationMinutes: interval at which the keys are rotated, 0 disables rotation
+// GraceMinutes: duration for which rotated keys are still published and accepted
+type KeysConfig struct {
+	Files           []string `json:"files"`
+	HMACSecret      string   `json:"hmacSecret"`
+	RotationMinutes int      `json:"rotationMinutes"`
+	GraceMinutes    int      `json:"graceMinutes"`
+}
+
 // AuthCodeConfig defines the variables required in the OAuth 2.0 Authorization Code flow
+//
+// Disabled: if true, the flow is turned off
 type AuthCodeConfig struct {
-	ClientID     string `json:"clientID"`
-	ClientSecret string `json:"clientSecret"`
+	Disabled bool `json:"disabled"`
+
+	AccessToken AccessTokenConfig `json:"accessToken"`
 }
 
 // ImplicitConfig defines the variables required in the OAuth 2.0 Implicit flow
 type ImplicitConfig struct {
-	ClientID string `json:"clientID"`
+	Disabled bool `json:"disabled"`
+
+	AccessToken AccessTokenConfig `json:"accessToken"`
 }
 
 // ROPCConfig defines the variables required in the OAuth 2.0 Resource Owner Password Credentials flow
+//
+// Username, Password: the credentials of the resource owner
 type ROPCConfig struct {
-	Username     string `json:"username"`
-	Password     string `json:"password"`
-	ClientID     string `json:"clientID"`
-	ClientSecret string `json:"clientSecret"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Disabled bool   `json:"disabled"`
+
+	AccessToken AccessTokenConfig `json:"accessToken"`
 }
 
 // ClientCredsConfig defines the variables required in the OAuth 2.0 Client Credentials flow
 type ClientCredsConfig struct {
-	ClientID     string `json:"clientID"`
-	ClientSecret string `json:"clientSecret"`
+	Disabled bool `json:"disabled"`
+
+	AccessToken AccessTokenConfig `json:"accessToken"`
+}
+
+// DeviceConfig defines the variables required in the OAuth 2.0 Device Authorization Grant flow
+type DeviceConfig struct {
+	Disabled bool `json:"disabled"`
+
+	AccessToken AccessTokenConfig `json:"accessToken"`
+}
+
+// UserConfig defines the profile of the resource owner who authorizes the requests.
+// It is returned as OpenID Connect claims in ID tokens and by the UserInfo endpoint.
+type UserConfig struct {
+	Subject           string `json:"subject"`
+	Name              string `json:"name"`
+	GivenName         string `json:"givenName"`
+	FamilyName        string `json:"familyName"`
+	PreferredUsername string `json:"preferredUsername"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"emailVerified"`
 }
 
 // OA2Config defines the configurations for all the flows in OAuth 2.0
+//
+// Clients: the clients which may use the flows, besides those created at the registration endpoint
+// Scopes: the catalog of scopes which clients may request, any scope may be requested if empty
 type OA2Config struct {
 	BaseURL         string            `json:"baseURL"`
+	Clients         []Client          `json:"clients"`
+	Scopes          []ScopeConfig     `json:"scopes"`
 	AuthCodeCnfg    AuthCodeConfig    `json:"authCode"`
 	ImplicitCnfg    ImplicitConfig    `json:"implicit"`
 	ROPCCnfg        ROPCConfig        `json:"ropc"`
 	ClientCredsCnfg ClientCredsConfig `json:"clientCreds"`
+	DeviceCnfg      DeviceConfig      `json:"device"`
+	User            UserConfig        `json:"user"`
+	Keys            KeysConfig        `json:"keys"`
+}
+
+// FindClient looks up a client of the server config by its ID.
+// Returns nil if there is no such client.
+func (c OA2Config) FindClient(clientID string) *Client {
+	if clientID == "" {
+		return nil
+	}
+
+	for i := range c.Clients {
+		if c.Clients[i].ClientID == clientID {
+			return &c.Clients[i]
+		}
+	}
+
+	return nil
+}
+
+// ClientFor returns the first client of the server config which may use the grant type,
+// or an empty client if there is none. It is used for presenting example credentials.
+func (c OA2Config) ClientFor(grantType string) Client {
+	for _, client := range c.Clients {
+		if client.AllowsGrantType(grantType) {
+			return client
+		}
+	}
+
+	return Client{}
+}
+
+// SigningAlgs returns the algorithms used for signing JWTs.
+// ID tokens are always signed with RS256, the rest depend on the access token formats.
+func (c OA2Config) SigningAlgs() []string {
+	algs := []string{"RS256"}
+	for _, tokenCnfg := range []AccessTokenConfig{
+		c.AuthCodeCnfg.AccessToken,
+		c.ImplicitCnfg.AccessToken,
+		c.ROPCCnfg.AccessToken,
+		c.ClientCredsCnfg.AccessToken,
+		c.DeviceCnfg.AccessToken,
+	} {
+		if !tokenCnfg.IsJWT() {
+			continue
+		}
+
+		alg, found := tokenCnfg.SigningAlg(), false
+		for _, existing := range algs {
+			found = found || existing == alg
+		}
+
+		if !found {
+			algs = append(algs, alg)
+		}
+	}
+
+	return algs
+}
+
+// IssuesJWTAccessTokens returns true if any of the enabled flows issues JWT access tokens
+func (c OA2Config) IssuesJWTAccessTokens() bool {
+	return (!c.AuthCodeCnfg.Disabled && c.AuthCodeCnfg.AccessToken.IsJWT()) ||
+		(!c.ImplicitCnfg.Disabled && c.ImplicitCnfg.AccessToken.IsJWT()) ||
+		(!c.ROPCCnfg.Disabled && c.ROPCCnfg.AccessToken.IsJWT()) ||
+		(!c.ClientCredsCnfg.Disabled && c.ClientCredsCnfg.AccessToken.IsJWT()) ||
+		(!c.DeviceCnfg.Disabled && c.DeviceCnfg.AccessToken.IsJWT())
+}
+
+// HasPublicClient returns true if any of the clients of the server config is public
+func (c OA2Config) HasPublicClient() bool {
+	for _, client := range c.Clients {
+		if client.IsPublic() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GrantTypesSupported returns the grant types of the enabled flows
+func (c OA2Config) GrantTypesSupported() []string {
+	var grantTypes []string
+	if !c.AuthCodeCnfg.Disabled {
+		grantTypes = append(grantTypes, "authorization_code")
+	}
+
+	if !c.ImplicitCnfg.Disabled {
+		grantTypes = append(grantTypes, "implicit")
+	}
+
+	if !c.ROPCCnfg.Disabled {
+		grantTypes = append(grantTypes, "password")
+	}
+
+	if !c.ClientCredsCnfg.Disabled {
+		grantTypes = append(grantTypes, "client_credentials")
+	}
+
+	if !c.DeviceCnfg.Disabled {
+		grantTypes = append(grantTypes, DeviceCodeGrantType)
+	}
+
+	// Refresh tokens are issued by the Authorization Code and ROPC flows
+	if !c.AuthCodeCnfg.Disabled || !c.ROPCCnfg.Disabled {
+		grantTypes = append(grantTypes, "refresh_token")
+	}
+
+	return grantTypes
+}
+
+// ResponseTypesSupported returns the response types of the enabled flows
+func (c OA2Config) ResponseTypesSupported() []string {
+	var responseTypes []string
+	if !c.AuthCodeCnfg.Disabled {
+		responseTypes = append(responseTypes, "code")
+	}
+
+	if !c.ImplicitCnfg.Disabled {
+		responseTypes = append(responseTypes, "token", "id_token", "id_token token")
+	}
+
+	return responseTypes
 }
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGrantTypesSupported(t *testing.T) {
+	var cnfg OA2Config
+	expected := []string{"authorization_code", "implicit", "password", "client_credentials", DeviceCodeGrantType, "refresh_token"}
+	if !reflect.DeepEqual(cnfg.GrantTypesSupported(), expected) {
+		t.Errorf("Unexpected grant types: %v", cnfg.GrantTypesSupported())
+	}
+
+	cnfg.AuthCodeCnfg.Disabled = true
+	cnfg.ROPCCnfg.Disabled = true
+	cnfg.DeviceCnfg.Disabled = true
+	expected = []string{"implicit", "client_credentials"}
+	if !reflect.DeepEqual(cnfg.GrantTypesSupported(), expected) {
+		t.Errorf("Unexpected grant types: %v", cnfg.GrantTypesSupported())
+	}
+}
+
+func TestResponseTypesSupported(t *testing.T) {
+	var cnfg OA2Config
+	cnfg.ImplicitCnfg.Disabled = true
+	if !reflect.DeepEqual(cnfg.ResponseTypesSupported(), []string{"code"}) {
+		t.Errorf("Unexpected response types: %v", cnfg.ResponseTypesSupported())
+	}
+}
+
+func TestSigningAlgs(t *testing.T) {
+	var cnfg OA2Config
+	cnfg.AuthCodeCnfg.AccessToken = AccessTokenConfig{Format: TokenFormatJWT}
+	cnfg.ROPCCnfg.AccessToken = AccessTokenConfig{Format: TokenFormatJWT, Alg: "ES256"}
+	cnfg.ClientCredsCnfg.AccessToken = AccessTokenConfig{Format: TokenFormatOpaque, Alg: "EdDSA"}
+
+	if !reflect.DeepEqual(cnfg.SigningAlgs(), []string{"RS256", "ES256"}) {
+		t.Errorf("Unexpected signing algorithms: %v", cnfg.SigningAlgs())
+	}
+}
+
+func TestFindClient(t *testing.T) {
+	cnfg := OA2Config{Clients: []Client{
+		{ClientID: "web", ClientSecret: "secret", GrantTypes: []string{"authorization_code"}},
+		{ClientID: "tv", GrantTypes: []string{DeviceCodeGrantType}},
+	}}
+
+	if client := cnfg.FindClient("tv"); client == nil || !client.IsPublic() {
+		t.Errorf("Unexpected client: %+v", client)
+	}
+
+	if cnfg.FindClient("") != nil || cnfg.FindClient("unknown") != nil {
+		t.Error("Found a client which is not in the config")
+	}
+
+	if cnfg.ClientFor(DeviceCodeGrantType).ClientID != "tv" || cnfg.ClientFor("password").ClientID != "" {
+		t.Error("Unexpected clients for the grant types")
+	}
+}
+
+func TestScopeCatalog(t *testing.T) {
+	var cnfg OA2Config
+	if !cnfg.KnowsScope("anything goes") {
+		t.Error("Scope rejected without a catalog")
+	}
+
+	cnfg.Scopes = []ScopeConfig{
+		{Name: "openid", Description: "Sign you in"},
+		{Name: "read"},
+	}
+
+	if !cnfg.KnowsScope("read  openid") || !cnfg.KnowsScope("") || cnfg.KnowsScope("read write") {
+		t.Error("Unexpected scope validation against the catalog")
+	}
+
+	expected := []ScopeConfig{
+		{Name: "openid", Description: "Sign you in"},
+		{Name: "read", Description: "read"},
+	}
+	if !reflect.DeepEqual(cnfg.DescribeScope("openid read"), expected) {
+		t.Errorf("Unexpected scope descriptions: %v", cnfg.DescribeScope("openid read"))
+	}
+}
+
+func TestScopeIncludes(t *testing.T) {
+	if !ScopeIncludes("read write", "write") || !ScopeIncludes("read", "") || ScopeIncludes("read", "read write") {
+		t.Error("Unexpected scope inclusion")
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import "strings"
+
+// ScopeConfig defines a scope of the catalog which clients may request
+//
+// Name: the scope value used in the scope parameter
+// Description: shown to the user on the authorization screen
+type ScopeConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// FindScope looks up a scope of the catalog by its name.
+// Returns nil if there is no such scope.
+func (c OA2Config) FindScope(name string) *ScopeConfig {
+	for i := range c.Scopes {
+		if c.Scopes[i].Name == name {
+			return &c.Scopes[i]
+		}
+	}
+
+	return nil
+}
+
+// KnowsScope checks if every space-separated value of the scope is in the catalog.
+// Any scope is known if the catalog is empty.
+func (c OA2Config) KnowsScope(scope string) bool {
+	if len(c.Scopes) == 0 {
+		return true
+	}
+
+	for _, value := range strings.Fields(scope) {
+		if c.FindScope(value) == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DescribeScope returns the catalog entries of the space-separated values of the scope.
+// Values which are not in the catalog are described by their name.
+func (c OA2Config) DescribeScope(scope string) []ScopeConfig {
+	var described []ScopeConfig
+	for _, value := range strings.Fields(scope) {
+		if entry := c.FindScope(value); entry != nil && entry.Description != "" {
+			described = append(described, *entry)
+		} else {
+			described = append(described, ScopeConfig{Name: value, Description: value})
+		}
+	}
+
+	return described
+}
+
+// ScopeNames returns the names of the scopes in the catalog
+func (c OA2Config) ScopeNames() []string {
+	var names []string
+	for _, scope := range c.Scopes {
+		names = append(names, scope.Name)
+	}
+
+	return names
+}
+
+// ScopeIncludes checks if every space-separated value of 'requested' is also a value of 'scope'.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.3
+func ScopeIncludes(scope, requested string) bool {
+	values := strings.Fields(scope)
+	for _, value := range strings.Fields(requested) {
+		found := false
+		for _, included := range values {
+			found = found || included == value
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,169 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Media types used in the typ header
+// Refer: https://tools.ietf.org/html/rfc7519#section-5.1 and https://tools.ietf.org/html/rfc9068#section-2.1
+const (
+	TypeJWT         = "JWT"
+	TypeAccessToken = "at+jwt"
+)
+
+// Holds the JOSE header of a JWT
+// Refer: https://tools.ietf.org/html/rfc7515#section-4
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Sign encodes the claims as a JWT signed with the server's active key for the algorithm.
+// Refer: https://tools.ietf.org/html/rfc7519#section-7.1
+func Sign(alg, typ string, claims interface{}) (string, error) {
+	key, err := ring.get(alg)
+	if err != nil {
+		return "", err
+	}
+
+	headerBytes, err := json.Marshal(header{Alg: alg, Typ: typ, Kid: key.id})
+	if err != nil {
+		return "", err
+	}
+
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encode(headerBytes) + "." + encode(claimsBytes)
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + encode(signature), nil
+}
+
+// Verify checks the type and signature of a JWT issued by this server and decodes its claims.
+// Tokens signed with retired keys are accepted until their grace period ends.
+// Validating the claims themselves, such as the expiry, is left to the caller.
+// Refer: https://tools.ietf.org/html/rfc7519#section-7.2
+func Verify(token, typ string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed JWT")
+	}
+
+	headerBytes, err := decode(parts[0])
+	if err != nil {
+		return err
+	}
+
+	var hdr header
+	err = json.Unmarshal(headerBytes, &hdr)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(hdr.Typ, typ) {
+		return fmt.Errorf("unexpected JWT type: %s", hdr.Typ)
+	}
+
+	// The algorithm is bound to the key to prevent algorithm substitution
+	key := ring.find(hdr.Kid)
+	if key == nil || key.alg != hdr.Alg {
+		return fmt.Errorf("unknown signing key or algorithm")
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil {
+		return err
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return fmt.Errorf("invalid JWT signature")
+	}
+
+	claimsBytes, err := decode(parts[1])
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(claimsBytes, claims)
+}
+
+// LeftHash computes the at_hash and c_hash claims of an ID token, i.e., the
+// base64url-encoded left-most half of the SHA-256 hash of the value.
+// Refer: https://openid.net/specs/openid-connect-core-1_0.html#CodeIDToken
+func LeftHash(value string) string {
+	digest := sha256.Sum256([]byte(value))
+	return encode(digest[:len(digest)/2])
+}
+
+// Computes the signature as per the key's algorithm.
+// ECDSA signatures are the concatenation of R and S rather than ASN.1 encoded.
+// Refer: https://tools.ietf.org/html/rfc7518#section-3.4
+func (key *signingKey) sign(input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+
+	switch k := key.signer.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+
+		return append(padTo(r.Bytes(), 32), padTo(s.Bytes(), 32)...), nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, input), nil
+	}
+
+	mac := hmac.New(sha256.New, key.secret)
+	mac.Write(input)
+	return mac.Sum(nil), nil
+}
+
+func (key *signingKey) verify(input, signature []byte) bool {
+	digest := sha256.Sum256(input)
+
+	switch k := key.signer.(type) {
+	case *rsa.PrivateKey:
+		return rsa.VerifyPKCS1v15(&k.PublicKey, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PrivateKey:
+		if len(signature) != 64 {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(&k.PublicKey, digest[:], r, s)
+	case ed25519.PrivateKey:
+		return ed25519.Verify(k.Public().(ed25519.PublicKey), input, signature)
+	}
+
+	expected, _ := key.sign(input)
+	return hmac.Equal(expected, signature)
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(str string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(str)
+}
@@ -0,0 +1,98 @@
+package jwt
+
+import (
+	"strings"
+	"testing"
+)
+
+type testClaims struct {
+	Issuer  string `json:"iss"`
+	Subject string `json:"sub"`
+}
+
+// TestSignVerify checks that signed tokens are verified and tampered ones are rejected
+func TestSignVerify(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA, AlgHS256} {
+		t.Run(alg, func(t *testing.T) {
+			token, err := Sign(alg, TypeJWT, testClaims{Issuer: "https://oauth2bin.org", Subject: "oa2buser"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var claims testClaims
+			err = Verify(token, TypeJWT, &claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.Subject != "oa2buser" {
+				t.Fatalf("Unexpected claims: %+v", claims)
+			}
+
+			parts := strings.Split(token, ".")
+			tampered, err := Sign(alg, TypeJWT, testClaims{Issuer: "https://oauth2bin.org", Subject: "admin"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			forged := parts[0] + "." + strings.Split(tampered, ".")[1] + "." + parts[2]
+			if Verify(forged, TypeJWT, &claims) == nil {
+				t.Fatal("Token with tampered claims verified")
+			}
+		})
+	}
+}
+
+// TestVerifyHeader checks that the type and algorithm in the header are enforced
+func TestVerifyHeader(t *testing.T) {
+	token, err := Sign(AlgES256, TypeAccessToken, testClaims{Subject: "oa2buser"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	if Verify(token, TypeJWT, &claims) == nil {
+		t.Fatal("Access token verified as an ID token")
+	}
+
+	if Verify(token, TypeAccessToken, &claims) != nil {
+		t.Fatal("Access token not verified")
+	}
+
+	// Header claiming HS256 with the ID of the ES256 key
+	key, _ := ring.get(AlgES256)
+	forgedHeader := encode([]byte(`{"alg":"HS256","typ":"at+jwt","kid":"` + key.id + `"}`))
+	parts := strings.Split(token, ".")
+	if Verify(forgedHeader+"."+parts[1]+"."+parts[2], TypeAccessToken, &claims) == nil {
+		t.Fatal("Token with substituted algorithm verified")
+	}
+}
+
+// TestJWKS checks that the published keys match the signing keys and omit HMAC keys
+func TestJWKS(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA, AlgHS256} {
+		if _, err := ring.get(alg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kty := map[string]string{AlgRS256: "RSA", AlgES256: "EC", AlgEdDSA: "OKP"}
+	keys := JWKS().Keys
+	if len(keys) != len(kty) {
+		t.Fatalf("Unexpected key set: %+v", keys)
+	}
+
+	for _, jwk := range keys {
+		key, _ := ring.get(jwk.Alg)
+		if jwk.Kid != key.id || jwk.Kty != kty[jwk.Alg] {
+			t.Errorf("Unexpected key: %+v", jwk)
+		}
+	}
+}
+
+// Example from OpenID Connect Core Appendix A.3
+func TestLeftHash(t *testing.T) {
+	if hash := LeftHash("jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"); hash != "77QmUPtjPfzWtF2AnpK9RQ" {
+		t.Fatalf("Unexpected at_hash: %s", hash)
+	}
+}
@@ -0,0 +1,435 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// Signing algorithms supported for JWTs
+// Refer: https://tools.ietf.org/html/rfc7518#section-3.1 and https://tools.ietf.org/html/rfc8037#section-3.1
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+	AlgHS256 = "HS256"
+)
+
+// JWK represents a public key as a JSON Web Key
+// Refer: https://tools.ietf.org/html/rfc7517#section-4
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// KeySet represents a JSON Web Key Set
+// Refer: https://tools.ietf.org/html/rfc7517#section-5
+type KeySet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// A key used for signing and verifying JWTs.
+// 'signer' holds the private key of asymmetric algorithms, 'secret' the HS256 key.
+// 'path' is the PEM file the key was loaded from, or generatedHMACKey for generated HS256 keys.
+type signingKey struct {
+	id        string
+	alg       string
+	signer    crypto.Signer
+	secret    []byte
+	path      string
+	retiredAt time.Time
+}
+
+// Holds the active key of every algorithm, along with the retired keys
+// which are still accepted and published until their grace period ends.
+type keyRing struct {
+	sync.RWMutex
+	active  map[string]*signingKey
+	retired []*signingKey
+	grace   time.Duration
+}
+
+var ring = &keyRing{active: make(map[string]*signingKey)}
+
+// Rotation goroutine, stopped when the keys are set up again
+var stopRotation chan struct{}
+
+// SetupKeys loads the keys from the PEM files in the config and generates keys for
+// the remaining algorithms. If a rotation interval is configured, a goroutine
+// periodically rotates the keys.
+func SetupKeys(cnfg config.KeysConfig, algs ...string) error {
+	ring.Lock()
+	ring.active = make(map[string]*signingKey)
+	ring.retired = nil
+	ring.grace = time.Duration(cnfg.GraceMinutes) * time.Minute
+	ring.Unlock()
+
+	for _, path := range cnfg.Files {
+		key, err := loadKey(path)
+		if err != nil {
+			return err
+		}
+
+		ring.activate(key)
+	}
+
+	if cnfg.HMACSecret != "" {
+		if len(cnfg.HMACSecret) < 32 {
+			return fmt.Errorf("the HS256 secret must be at least 32 bytes long")
+		}
+
+		ring.activate(newHMACKey([]byte(cnfg.HMACSecret)))
+	}
+
+	for _, alg := range algs {
+		_, err := ring.get(alg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if stopRotation != nil {
+		close(stopRotation)
+		stopRotation = nil
+	}
+
+	if cnfg.RotationMinutes > 0 {
+		stopRotation = make(chan struct{})
+		go rotatePeriodically(time.Duration(cnfg.RotationMinutes)*time.Minute, stopRotation)
+	}
+
+	return nil
+}
+
+// Rotate replaces the active keys. Generated keys are replaced with new ones
+// and keys loaded from files are read again, so that the files can be replaced
+// with new keys. Replaced keys are retired and remain valid for the grace period.
+func Rotate() error {
+	ring.Lock()
+	defer ring.Unlock()
+
+	now := time.Now()
+	for alg, key := range ring.active {
+		var next *signingKey
+		var err error
+
+		switch {
+		case key.path == generatedHMACKey:
+			next, err = generateKey(alg)
+		case key.path != "":
+			next, err = loadKey(key.path)
+		case key.signer == nil:
+			// A configured HS256 secret cannot be rotated by the server
+			continue
+		default:
+			next, err = generateKey(alg)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if next.id == key.id {
+			continue
+		}
+
+		key.retiredAt = now
+		ring.retired = append(ring.retired, key)
+		ring.active[alg] = next
+	}
+
+	ring.pruneRetired(now)
+	return nil
+}
+
+// JWKS returns the key set holding the public keys of the active and retired keys.
+// HS256 keys are symmetric and are thus never published.
+func JWKS() KeySet {
+	ring.Lock()
+	defer ring.Unlock()
+	ring.pruneRetired(time.Now())
+
+	keySet := KeySet{Keys: []JWK{}}
+	for _, alg := range []string{AlgRS256, AlgES256, AlgEdDSA} {
+		if key, found := ring.active[alg]; found {
+			keySet.Keys = append(keySet.Keys, key.publicJWK())
+		}
+	}
+
+	for _, key := range ring.retired {
+		if key.signer != nil {
+			keySet.Keys = append(keySet.Keys, key.publicJWK())
+		}
+	}
+
+	return keySet
+}
+
+// Returns the active key for the algorithm, generating one if needed.
+func (kr *keyRing) get(alg string) (*signingKey, error) {
+	kr.RLock()
+	key, found := kr.active[alg]
+	kr.RUnlock()
+
+	if found {
+		return key, nil
+	}
+
+	key, err := generateKey(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	kr.Lock()
+	defer kr.Unlock()
+
+	// Another goroutine may have generated a key in the meantime
+	if existing, found := kr.active[alg]; found {
+		return existing, nil
+	}
+
+	kr.active[alg] = key
+	return key, nil
+}
+
+// Looks up an active or retired key by its ID.
+func (kr *keyRing) find(kid string) *signingKey {
+	kr.RLock()
+	defer kr.RUnlock()
+
+	for _, key := range kr.active {
+		if key.id == kid {
+			return key
+		}
+	}
+
+	now := time.Now()
+	for _, key := range kr.retired {
+		if key.id == kid && now.Sub(key.retiredAt) < kr.grace {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (kr *keyRing) activate(key *signingKey) {
+	kr.Lock()
+	defer kr.Unlock()
+	kr.active[key.alg] = key
+}
+
+// Removes the retired keys whose grace period has ended.
+// Must be called with the lock held.
+func (kr *keyRing) pruneRetired(now time.Time) {
+	var retained []*signingKey
+	for _, key := range kr.retired {
+		if now.Sub(key.retiredAt) < kr.grace {
+			retained = append(retained, key)
+		}
+	}
+
+	kr.retired = retained
+}
+
+// Rotates the keys at the given interval until 'stop' is closed.
+func rotatePeriodically(interval time.Duration, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+			err := Rotate()
+			if err != nil {
+				log.Println("Key rotation failed: " + err.Error())
+			} else {
+				log.Println("Signing keys rotated")
+			}
+		}
+	}
+}
+
+// Generates a new key for the algorithm.
+func generateKey(alg string) (*signingKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch alg {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case AlgHS256:
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		key := newHMACKey(secret)
+		key.path = generatedHMACKey
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newAsymmetricKey(signer)
+}
+
+// Marks HS256 keys generated by the server, as opposed to configured ones
+const generatedHMACKey = "<generated>"
+
+// Reads a PEM-encoded private key. PKCS #1 and SEC 1 keys are supported,
+// along with RSA, EC and Ed25519 keys in PKCS #8.
+// The algorithm is determined by the type of the key.
+func loadKey(path string) (*signingKey, error) {
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block type %s", path, block.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type", path)
+	}
+
+	key, err := newAsymmetricKey(signer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	key.path = path
+	return key, nil
+}
+
+func newAsymmetricKey(signer crypto.Signer) (*signingKey, error) {
+	key := &signingKey{signer: signer}
+
+	switch k := signer.(type) {
+	case *rsa.PrivateKey:
+		key.alg = AlgRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("only EC keys on the P-256 curve are supported")
+		}
+		key.alg = AlgES256
+	case ed25519.PrivateKey:
+		key.alg = AlgEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type")
+	}
+
+	key.id = key.publicJWK().thumbprint()
+	return key, nil
+}
+
+func newHMACKey(secret []byte) *signingKey {
+	// The ID must not reveal the secret, hence the double hashing
+	digest := sha256.Sum256(secret)
+	digest = sha256.Sum256(digest[:])
+
+	return &signingKey{
+		id:     encode(digest[:12]),
+		alg:    AlgHS256,
+		secret: secret,
+	}
+}
+
+// Represents the public part of the key as a JWK
+func (key *signingKey) publicJWK() JWK {
+	jwk := JWK{Use: "sig", Alg: key.alg, Kid: key.id}
+
+	switch k := key.signer.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(k.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = encode(padTo(k.X.Bytes(), 32))
+		jwk.Y = encode(padTo(k.Y.Bytes(), 32))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(k)
+	}
+
+	return jwk
+}
+
+// Computes the JWK thumbprint which is used as the key ID.
+// Refer: https://tools.ietf.org/html/rfc7638#section-3
+func (jwk JWK) thumbprint() string {
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, jwk.Crv, jwk.X)
+	}
+
+	digest := sha256.Sum256([]byte(members))
+	return encode(digest[:])
+}
+
+// Left-pads the bytes with zeroes to the given length
+func padTo(b []byte, length int) []byte {
+	if len(b) >= length {
+		return b
+	}
+
+	padded := make([]byte, length)
+	copy(padded[length-len(b):], b)
+	return padded
+}
@@ -0,0 +1,115 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// Writes the private key to a PEM file in dir and returns its path
+func writeKeyFile(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// TestSetupKeys checks that keys are loaded from PEM files and generated for other algorithms
+func TestSetupKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oa2b-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+
+	err = SetupKeys(config.KeysConfig{
+		Files: []string{
+			writeKeyFile(t, dir, "ec.pem", "EC PRIVATE KEY", ecDER),
+			writeKeyFile(t, dir, "ed25519.pem", "PRIVATE KEY", edDER),
+		},
+		HMACSecret: "a secret which is at least 32 bytes long",
+	}, AlgRS256, AlgES256, AlgEdDSA, AlgHS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for alg, private := range map[string]crypto.Signer{AlgES256: ecKey, AlgEdDSA: edKey} {
+		key, _ := ring.get(alg)
+		expected, _ := newAsymmetricKey(private)
+		if key.path == "" || key.id != expected.id {
+			t.Errorf("%s key not loaded from file", alg)
+		}
+	}
+
+	if key, _ := ring.get(AlgRS256); key.path != "" {
+		t.Error("RS256 key not generated")
+	}
+
+	if SetupKeys(config.KeysConfig{HMACSecret: "too short"}) == nil {
+		t.Error("Short HMAC secret accepted")
+	}
+
+	if SetupKeys(config.KeysConfig{}, "none") == nil {
+		t.Error("Unsupported algorithm accepted")
+	}
+}
+
+// TestRotate checks that tokens signed with rotated keys are accepted only during the grace period
+func TestRotate(t *testing.T) {
+	for _, grace := range []int{60, 0} {
+		err := SetupKeys(config.KeysConfig{GraceMinutes: grace}, AlgRS256, AlgHS256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rsToken, _ := Sign(AlgRS256, TypeJWT, testClaims{Subject: "oa2buser"})
+		hsToken, _ := Sign(AlgHS256, TypeJWT, testClaims{Subject: "oa2buser"})
+		previous, _ := ring.get(AlgRS256)
+
+		err = Rotate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if current, _ := ring.get(AlgRS256); current.id == previous.id {
+			t.Fatal("Key not rotated")
+		}
+
+		var claims testClaims
+		for _, token := range []string{rsToken, hsToken} {
+			verified := Verify(token, TypeJWT, &claims) == nil
+			if verified != (grace > 0) {
+				t.Errorf("Token signed with a rotated key verified: %t, grace period: %d", verified, grace)
+			}
+		}
+
+		published := 0
+		for _, jwk := range JWKS().Keys {
+			if jwk.Kid == previous.id {
+				published++
+			}
+		}
+
+		if published != 1 && grace > 0 || published != 0 && grace == 0 {
+			t.Errorf("Rotated key published %d times, grace period: %d", published, grace)
+		}
+	}
+}
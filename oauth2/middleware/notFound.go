@@ -3,6 +3,7 @@ package middleware
 import (
 	"log"
 	"net/http"
+	"strings"
 	"text/template"
 )
 
@@ -19,7 +20,7 @@ func NewNotFoundMiddleware(pattern string) NotFoundMiddleware {
 // Handle checks if the request's path matches URLPattern
 func (nfm NotFoundMiddleware) Handle(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != nfm.URLPattern {
+		if !nfm.matches(r.URL.Path) {
 			// Serve the 404 page
 			tmpl, err := template.ParseFiles(
 				"public/templates/404.html",
@@ -41,3 +42,13 @@ func (nfm NotFoundMiddleware) Handle(handler http.HandlerFunc) http.HandlerFunc
 		handler.ServeHTTP(w, r)
 	}
 }
+
+// Checks if the path matches URLPattern exactly. Patterns other than "/" which
+// end in a slash match the subtree rooted at them, as in http.ServeMux.
+func (nfm NotFoundMiddleware) matches(path string) bool {
+	if nfm.URLPattern != "/" && strings.HasSuffix(nfm.URLPattern, "/") {
+		return strings.HasPrefix(path, nfm.URLPattern)
+	}
+
+	return path == nfm.URLPattern
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import "testing"
+
+func TestNotFoundMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		matches bool
+	}{
+		{"/", "/", true},
+		{"/", "/unknown", false},
+		{"/token", "/token", true},
+		{"/token", "/token/", false},
+		{"/register/", "/register/clientID", true},
+		{"/register/", "/register", false},
+	}
+
+	for _, test := range tests {
+		if NewNotFoundMiddleware(test.pattern).matches(test.path) != test.matches {
+			t.Errorf("Pattern %s matching %s: expected %t", test.pattern, test.path, test.matches)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"mime"
 	"net/http"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
@@ -32,8 +33,10 @@ func (pfv PostFormValidator) Handle(handler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// Parameters such as charset are allowed along with the media type
 		contentType := r.Header.Get("Content-Type")
-		if contentType != "application/x-www-form-urlencoded" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/x-www-form-urlencoded" {
 			title := "Bad Request"
 
 			var desc string
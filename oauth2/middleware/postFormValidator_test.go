@@ -25,6 +25,7 @@ func TestPostFormValidatorHandle(t *testing.T) {
 	testPostRequest(t, handler)
 	testNoContentType(t, handler)
 	testContentType(t, handler)
+	testContentTypeParams(t, handler)
 }
 
 // Checks if a HTTP 405 status code is received on a GET request
@@ -90,3 +91,20 @@ func testNoContentType(t *testing.T, handler http.HandlerFunc) {
 		t.Fatal("Request with no content-type accepted by PostFormValidator middleware")
 	}
 }
+
+// Checks if a POST request is accepted when the content-type has parameters
+func testContentTypeParams(t *testing.T, handler http.HandlerFunc) {
+	recorder := httptest.NewRecorder()
+
+	postReq, err := http.NewRequest(http.MethodPost, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postReq.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+
+	handler.ServeHTTP(recorder, postReq)
+	if recorder.Code != http.StatusOK {
+		t.Fatal("application/x-www-form-urlencoded request with charset rejected by PostFormValidator middleware")
+	}
+}
@@ -1,11 +1,13 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
-	"github.com/gomodule/redigo/redis"
 )
 
 // RatePolicy represents the rate limiting policy
@@ -14,17 +16,41 @@ import (
 // Route: the server route to apply the policy to
 // Limit: the number of API calls allowed
 // Minutes: the duration in minutes over which 'Limit' is imposed
+// Algorithm: how the requests are counted, cache.FixedWindow unless set
+// Burst: the number of requests allowed at once by the cache.TokenBucket algorithm, 'Limit' unless set
 type RatePolicy struct {
-	Route   string `json:"route"`
-	Limit   int    `json:"limit"`
-	Minutes int    `json:"minutes"`
+	Route     string              `json:"route"`
+	Limit     int                 `json:"limit"`
+	Minutes   int                 `json:"minutes"`
+	Algorithm cache.RateAlgorithm `json:"algorithm,omitempty"`
+	Burst     int                 `json:"burst,omitempty"`
+}
+
+// Validate checks that the policy names a known algorithm with the parameters it needs
+func (policy RatePolicy) Validate() error {
+	algorithm, err := cache.ParseRateAlgorithm(string(policy.Algorithm))
+	if err != nil {
+		return err
+	}
+
+	if algorithm != cache.FixedWindow && (policy.Limit <= 0 || policy.Minutes <= 0) {
+		return fmt.Errorf("%s expects a positive limit and minutes", algorithm)
+	} else if policy.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+
+	return nil
 }
 
 // RateLimiter is an implementation of Middleware.
 // It holds a list of policies that are checked
 // when the CheckLimit method is invoked.
+//
+// Failure decides whether requests are let through (cache.FailOpen, the default)
+// or rejected (cache.FailClosed) while the hits cannot be counted.
 type RateLimiter struct {
 	Policies []RatePolicy
+	Failure  cache.FailurePolicy
 }
 
 // Handle checks if the client is within the limits enforced by the policies
@@ -38,14 +64,20 @@ func (rl RateLimiter) Handle(handler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		hits, err := setHit(policy, r.RemoteAddr)
+		allowed, err := setHit(policy, r.RemoteAddr)
 		if err != nil {
-			// letting this request pass since there may be an issue with Redis
+			log.Printf("Could not count the hit on %s, failing %s: %s\n", policy.Route, rl.FailurePolicy(), err)
+			if rl.FailurePolicy() == cache.FailClosed {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintln(w, "Rate limits cannot be enforced at the moment, please try again later.")
+				return
+			}
+
 			handler.ServeHTTP(w, r)
 			return
 		}
 
-		if hits > policy.Limit {
+		if !allowed {
 			showError(policy, w, r)
 		} else {
 			handler.ServeHTTP(w, r)
@@ -53,6 +85,15 @@ func (rl RateLimiter) Handle(handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// FailurePolicy returns the failure policy, which defaults to cache.FailOpen
+func (rl RateLimiter) FailurePolicy() cache.FailurePolicy {
+	if rl.Failure == "" {
+		return cache.FailOpen
+	}
+
+	return rl.Failure
+}
+
 // Searches the policies based on the route
 func (rl RateLimiter) getRatePolicy(route string) *RatePolicy {
 	for _, policy := range rl.Policies {
@@ -64,28 +105,16 @@ func (rl RateLimiter) getRatePolicy(route string) *RatePolicy {
 	return nil
 }
 
-// TODO: try to use goroutines for Redis calls
-// Registers a new hit for the route from the IP in Redis.
-// Returns the current hit count or an error.
-func setHit(policy *RatePolicy, ip string) (int, error) {
-	conn := cache.NewConn()
-	defer cache.CloseConn(conn)
-
+// Registers a new hit for the route from the IP.
+// Returns whether the hit is within the limit, or an error.
+func setHit(policy *RatePolicy, ip string) (bool, error) {
 	key := fmt.Sprintf("%s:%s", policy.Route, ip)
-	res, err := redis.String(conn.Do("GET", key))
-
-	// if key exists, increment
-	if err == nil {
-		return redis.Int(conn.Do("INCR", key))
-		// else, set key with value 1 and set TTL according to policy
-	} else if res == "" && err == redis.ErrNil {
-		res, err = redis.String(conn.Do("SET", key, 1, "EX", policy.Minutes*60))
-		if res == "OK" {
-			return 1, nil
-		}
-	}
-
-	return -1, nil
+	return cache.HitRateLimit(key, cache.RateLimit{
+		Algorithm: policy.Algorithm,
+		Limit:     policy.Limit,
+		Window:    time.Duration(policy.Minutes) * time.Minute,
+		Burst:     policy.Burst,
+	})
 }
 
 func showError(policy *RatePolicy, w http.ResponseWriter, r *http.Request) {
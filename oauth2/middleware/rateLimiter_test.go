@@ -5,8 +5,12 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
 )
 
 func TestLimiterHandle(t *testing.T) {
@@ -64,3 +68,84 @@ func TestLimiterHandle(t *testing.T) {
 		t.Fatalf("HTTP %d: request allowed beyond policy limit\n", res.StatusCode)
 	}
 }
+
+// TestLimiterFailure checks that requests are let through or rejected as per
+// the failure policy while the store is unavailable
+func TestLimiterFailure(t *testing.T) {
+	os.Setenv("REDIS_URL", "redis://127.0.0.1:1")
+	defer os.Unsetenv("REDIS_URL")
+
+	err := cache.OpenStore(cache.RedisStore, "", cache.FailClosed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.OpenStore(cache.MemoryStore, "", cache.FailOpen)
+
+	policies := []RatePolicy{{Route: "/limited", Limit: 5, Minutes: 1}}
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	tests := map[cache.FailurePolicy]int{
+		"":               http.StatusOK,
+		cache.FailOpen:   http.StatusOK,
+		cache.FailClosed: http.StatusServiceUnavailable,
+	}
+
+	for failure, status := range tests {
+		limiter := RateLimiter{Policies: policies, Failure: failure}
+		recorder := httptest.NewRecorder()
+		limiter.Handle(handler)(recorder, httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+		if recorder.Code != status {
+			t.Errorf("Failing %q: HTTP %d, expected %d", failure, recorder.Code, status)
+		}
+	}
+}
+
+// TestLimiterTokenBucket checks that a client may burst beyond the limit of a token bucket,
+// until the bucket is empty
+func TestLimiterTokenBucket(t *testing.T) {
+	policies := []RatePolicy{{Route: "/bucket", Limit: 1, Minutes: 1, Algorithm: cache.TokenBucket, Burst: 3}}
+	limiter := RateLimiter{Policies: policies}
+	handler := limiter.Handle(func(w http.ResponseWriter, r *http.Request) {})
+
+	for i := 1; i <= 4; i++ {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/bucket", nil))
+
+		status := http.StatusOK
+		if i > 3 {
+			status = http.StatusTooManyRequests
+		}
+
+		if recorder.Code != status {
+			t.Fatalf("Request %d: HTTP %d, expected %d", i, recorder.Code, status)
+		}
+	}
+}
+
+func TestRatePolicyValidate(t *testing.T) {
+	valid := []RatePolicy{
+		{Route: "/", Limit: 10, Minutes: 1},
+		{Route: "/", Limit: 10, Minutes: 1, Algorithm: cache.SlidingWindowLog},
+		{Route: "/", Limit: 10, Minutes: 1, Algorithm: cache.TokenBucket, Burst: 20},
+	}
+
+	for _, policy := range valid {
+		if err := policy.Validate(); err != nil {
+			t.Errorf("%+v: %s", policy, err)
+		}
+	}
+
+	invalid := []RatePolicy{
+		{Route: "/", Limit: 10, Minutes: 1, Algorithm: "leaky_bucket"},
+		{Route: "/", Limit: 0, Minutes: 1, Algorithm: cache.SlidingWindowCounter},
+		{Route: "/", Limit: 10, Minutes: 0, Algorithm: cache.TokenBucket},
+		{Route: "/", Limit: 10, Minutes: 1, Algorithm: cache.TokenBucket, Burst: -1},
+	}
+
+	for _, policy := range invalid {
+		if policy.Validate() == nil {
+			t.Errorf("%+v: accepted", policy)
+		}
+	}
+}
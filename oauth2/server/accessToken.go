@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/jwt"
+)
+
+// Claims of a JWT access token
+// Refer: https://tools.ietf.org/html/rfc9068#section-2.2
+type accessTokenClaims struct {
+	Issuer   string `json:"iss"`
+	Subject  string `json:"sub"`
+	Audience string `json:"aud"`
+	ClientID string `json:"client_id"`
+	Expiry   int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	JWTID    string `json:"jti"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+// Formats the opaque access token issued by the store as configured for the flow.
+// The opaque token is a bearer credential, hence JWT access tokens do not carry it.
+// Their jti is mapped to it instead, which remains the key used for looking up the token in the store.
+func formatAccessToken(cnfg config.AccessTokenConfig, accessToken string) (string, error) {
+	if !cnfg.IsJWT() {
+		return accessToken, nil
+	}
+
+	info, err := cache.IntrospectToken(accessToken, cache.AccessTokenHint)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.Active {
+		return "", fmt.Errorf("access token expired before it could be issued")
+	}
+
+	jwtID, err := cache.NewJWTID(accessToken, time.Unix(info.Exp, 0))
+	if err != nil {
+		return "", err
+	}
+
+	claims := accessTokenClaims{
+		Issuer:   serverConfig.BaseURL,
+		Subject:  info.Subject,
+		Audience: cnfg.Audience,
+		ClientID: info.ClientID,
+		Expiry:   info.Exp,
+		IssuedAt: info.Iat,
+		JWTID:    jwtID,
+		Scope:    info.Scope,
+	}
+
+	// Tokens issued to clients on their own behalf identify the client as the subject
+	if claims.Subject == "" {
+		claims.Subject = info.ClientID
+	}
+
+	if claims.Audience == "" {
+		claims.Audience = serverConfig.BaseURL
+	}
+
+	return jwt.Sign(cnfg.SigningAlg(), jwt.TypeAccessToken, claims)
+}
+
+// Resolves a JWT access token to the opaque token its jti is mapped to.
+// Other tokens, and JWTs which fail verification or whose jti is unknown, are returned unchanged
+// so that they are treated as unknown tokens by the store.
+func resolveAccessToken(token string) string {
+	if strings.Count(token, ".") != 2 {
+		return token
+	}
+
+	var claims accessTokenClaims
+	err := jwt.Verify(token, jwt.TypeAccessToken, &claims)
+	if err != nil || claims.JWTID == "" {
+		return token
+	}
+
+	accessToken, err := cache.ResolveJWTID(claims.JWTID)
+	if err != nil {
+		log.Println(err)
+	}
+
+	if accessToken == "" {
+		return token
+	}
+
+	return accessToken
+}
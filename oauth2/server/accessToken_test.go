@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/jwt"
+)
+
+// TestJWTAccessToken checks that JWT access tokens do not reveal the opaque token
+// they stand for, and are resolved to it
+func TestJWTAccessToken(t *testing.T) {
+	err := jwt.SetupKeys(config.KeysConfig{}, "HS256")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := cache.NewClientCredsToken("clientID", "", config.TokenLifetimes{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := formatAccessToken(config.AccessTokenConfig{Format: config.TokenFormatJWT, Alg: "HS256"}, token.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(signed, ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims accessTokenClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.JWTID == "" || strings.Contains(string(payload), token.AccessToken) {
+		t.Fatalf("JWT access token reveals the opaque token: %s", payload)
+	}
+
+	if resolved := resolveAccessToken(signed); resolved != token.AccessToken {
+		t.Fatalf("JWT access token resolved to %q", resolved)
+	}
+}
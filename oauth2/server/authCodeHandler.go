@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
@@ -10,45 +11,75 @@ import (
 	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
 )
 
-// handleAuthCodeAuth checks for the existence of client_id in the query parameters.
-// If not present, an HTTP 400 response is sent.
-// If an unrecognized client_id is found, an HTTP 401 response is sent.
-// Else, an authorization screen is presented to the user.
-func handleAuthCodeAuth(w http.ResponseWriter, r *http.Request) {
+// handleAuthCodeAuth checks the PKCE parameters of an authorization request whose client
+// and redirect URI have already been validated.
+// If the PKCE parameters are malformed, or missing while the client requires PKCE, an invalid_request error is returned.
+// Else, the request is stored and an authorization screen is presented to the user.
+func handleAuthCodeAuth(w http.ResponseWriter, r *http.Request, request *cache.AuthRequest, client *config.Client) {
 	queryParams := r.URL.Query()
-	clientID := queryParams.Get("client_id")
-
-	switch clientID {
-	case "":
-		utils.ShowError(w, r, 400, "Bad Request", "client_id is required")
-	case serverConfig.AuthCodeCnfg.ClientID:
-		utils.PresentAuthScreen(w, r, config.AuthCode)
-	default:
-		utils.ShowError(w, r, 401, "Unauthorized", "Invalid client_id")
+
+	challenge := queryParams.Get("code_challenge")
+	method, err := cache.ValidateCodeChallenge(challenge, queryParams.Get("code_challenge_method"))
+	if err != nil {
+		redirectAuthError(w, r, request, "invalid_request", err.Error())
+		return
+	}
+
+	if challenge == "" && client.RequirePKCE {
+		redirectAuthError(w, r, request, "invalid_request", "code_challenge is required for this client")
+		return
 	}
+
+	request.CodeChallenge = challenge
+	request.CodeChallengeMethod = method
+	presentAuthScreen(w, r, request)
 }
 
 // handleAuthCodeToken checks for the existence of all parameters detailed in Section 4.1.3 of RFC 6749 (https://tools.ietf.org/html/rfc6749#section-4.1.3).
-// If not present, an HTTP 400 response is sent.
+// If not present, an invalid_request error is sent.
+// If the client fails to authenticate, an invalid_client error is sent.
+// If the client may not use the flow, an unauthorized_client error is sent.
+// If the grant is invalid, was issued to another client, or the redirect_uri or PKCE code_verifier
+// does not match, an invalid_grant error is sent.
 // Else, a new token is generated, added to the store, and returned to the user in a JSON response.
 func handleAuthCodeToken(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if params["client_id"] == "" || params["grant_type"] == "" || params["code"] == "" {
+	// The redirect URI is checked against the grant, since it is only required if the client sent it to /authorize
+	// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.3
+	if params["code"] == "" {
 		utils.ShowJSONError(w, r, 400, utils.RequestError{
 			Error: "invalid_request",
-			Desc:  "client_id, grant_type=authorization_code, code and redirect_uri are required",
+			Desc:  "code is required",
 		})
 		return
 	}
 
-	token, err := cache.NewAuthCodeToken(params["code"], "", params["redirect_uri"])
+	if authenticateTokenClient(w, r, params, "authorization_code") == nil {
+		return
+	}
+
+	token, grant, err := cache.NewAuthCodeToken(params["code"], "", params["redirect_uri"], params["code_verifier"], params["client_id"])
 	if err != nil {
-		utils.ShowJSONError(w, r, 400, utils.RequestError{
-			Error: "invalid_request",
-			Desc:  err.Error(),
-		})
+		showInvalidGrant(w, r, err)
+		return
+	}
+
+	token.AccessToken, err = formatAccessToken(serverConfig.AuthCodeCnfg.AccessToken, token.AccessToken)
+	if err != nil {
+		log.Println(err)
+		showServerError(w, r)
 		return
 	}
 
+	// OpenID Connect: issue an ID token if the openid scope was requested
+	if utils.ScopeContains(grant.Scope, OpenIDScope) {
+		token.IDToken, err = newIDToken(grant.ClientID, grant.Subject, grant.Nonce, token.AccessToken, grant.AuthTime)
+		if err != nil {
+			log.Println(err)
+			showServerError(w, r)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
 	jsonBytes, err := json.Marshal(token)
 
@@ -56,26 +87,33 @@ func handleAuthCodeToken(w http.ResponseWriter, r *http.Request, params map[stri
 }
 
 // Refer RFC 6749 Section 6 (https://tools.ietf.org/html/rfc6749#section-6)
-func handleAuthCodeRefresh(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	// If found, invalidate previously issued token
-	if cache.AuthCodeRefreshTokenExists(params["refresh_token"], true) {
-		token, err := cache.NewAuthCodeRefreshToken(params["refresh_token"])
-		if err != nil {
-			utils.ShowJSONError(w, r, 500, utils.RequestError{
-				Error: "Internal Server Error",
-				Desc:  "Token generation failed. Please try again.",
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-		jsonBytes, err := json.Marshal(token)
-
-		fmt.Fprintln(w, string(jsonBytes))
-	} else {
-		utils.ShowJSONError(w, r, 400, utils.RequestError{
-			Error: "invalid_refresh_token",
-			Desc:  "expired or invalid refresh token",
+func handleAuthCodeRefresh(w http.ResponseWriter, r *http.Request, params map[string]string, client *config.Client) {
+	// Invalidates the previously issued token, if found
+	token, err := cache.NewAuthCodeRefreshToken(params["refresh_token"], client.ClientID, params["scope"], client.RotateRefreshTokens)
+	if err == cache.ErrInvalidRefreshToken || err == cache.ErrRefreshTokenReused {
+		showInvalidGrant(w, r, err)
+		return
+	} else if err == cache.ErrInvalidScope {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_scope",
+			Desc:  err.Error(),
 		})
+		return
+	} else if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
+	}
+
+	token.AccessToken, err = formatAccessToken(serverConfig.AuthCodeCnfg.AccessToken, token.AccessToken)
+	if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	jsonBytes, err := json.Marshal(token)
+
+	fmt.Fprintln(w, string(jsonBytes))
 }
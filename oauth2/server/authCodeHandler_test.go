@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestAuthCodeConcurrentRedemption fires parallel token requests with the same
+// authorization grant and checks that at most one of them is issued a token,
+// which is revoked since the others replay the grant.
+func TestAuthCodeConcurrentRedemption(t *testing.T) {
+	serverConfig = config.OA2Config{
+		Clients: []config.Client{{
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+			RedirectURIs: []string{"https://oauth2bin.org"},
+			GrantTypes:   []string{"authorization_code"},
+		}},
+	}
+
+	code, err := cache.NewAuthCodeGrant(cache.AuthCodeGrant{ClientID: "clientID", RedirectURI: "https://oauth2bin.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := url.Values{}
+	body.Set("grant_type", "authorization_code")
+	body.Set("code", code)
+	body.Set("redirect_uri", "https://oauth2bin.org")
+
+	const requests = 20
+	responses := make(chan *httptest.ResponseRecorder, requests)
+	start := make(chan struct{})
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(body.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetBasicAuth("clientID", "clientSecret")
+			w := httptest.NewRecorder()
+
+			<-start
+			handleToken(w, r)
+			responses <- w
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(responses)
+
+	issued := 0
+	for w := range responses {
+		switch w.Code {
+		case http.StatusOK:
+			issued++
+
+			var token cache.AuthCodeToken
+			err = json.Unmarshal(w.Body.Bytes(), &token)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cache.VerifyAuthCodeToken(token.AccessToken) {
+				t.Error("Token issued on a replayed grant was not revoked")
+			}
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("Unexpected status: %d", w.Code)
+		}
+	}
+
+	if issued > 1 {
+		t.Fatalf("Expected at most one token to be issued, got %d", issued)
+	}
+}
+
+// TestAuthCodeStoreFailure checks that authorization and refresh requests fail,
+// rather than hang, while the store is unavailable and failing closed
+func TestAuthCodeStoreFailure(t *testing.T) {
+	serverConfig = config.OA2Config{
+		Clients: []config.Client{{
+			ClientID:     "clientID",
+			ClientSecret: "clientSecret",
+			RedirectURIs: []string{"https://oauth2bin.org"},
+			GrantTypes:   []string{"authorization_code", "refresh_token"},
+		}},
+	}
+
+	defer chdirRepositoryRoot(t)()
+
+	os.Setenv("REDIS_URL", "redis://127.0.0.1:1")
+	defer os.Unsetenv("REDIS_URL")
+
+	err := cache.OpenStore(cache.RedisStore, "", cache.FailClosed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.OpenStore(cache.MemoryStore, "", cache.FailOpen)
+
+	response := httptest.NewRequest(http.MethodPost, "/response?requestID=request", strings.NewReader("response=ACCEPT"))
+	response.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response.AddCookie(&http.Cookie{Name: csrfCookiePrefix + "request", Value: "csrf"})
+
+	body := url.Values{}
+	body.Set("grant_type", "refresh_token")
+	body.Set("refresh_token", cache.AuthCodeFlowID+"refreshToken")
+
+	refresh := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(body.Encode()))
+	refresh.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	refresh.SetBasicAuth("clientID", "clientSecret")
+
+	requests := map[*http.Request]http.HandlerFunc{response: handleResponse, refresh: handleToken}
+	for r, handler := range requests {
+		w := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			handler(w, r)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: no response while the store is unavailable", r.URL.Path)
+		}
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: HTTP %d, expected %d", r.URL.Path, w.Code, http.StatusInternalServerError)
+		}
+	}
+}
+
+// TestAuthCodeRequirePKCE checks that PKCE is only required from the clients which require it
+func TestAuthCodeRequirePKCE(t *testing.T) {
+	defer chdirRepositoryRoot(t)()
+
+	serverConfig = config.OA2Config{
+		Clients: []config.Client{
+			{ClientID: "pkceClient", RedirectURIs: []string{"https://oauth2bin.org"}, GrantTypes: []string{"authorization_code"}, RequirePKCE: true},
+			{ClientID: "otherClient", RedirectURIs: []string{"https://oauth2bin.org"}, GrantTypes: []string{"authorization_code"}},
+		},
+	}
+
+	tests := []struct {
+		clientID  string
+		challenge string
+		rejected  bool
+	}{
+		{"pkceClient", "", true},
+		{"pkceClient", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", false},
+		{"otherClient", "", false},
+	}
+
+	for _, test := range tests {
+		query := url.Values{}
+		query.Set("client_id", test.clientID)
+		query.Set("redirect_uri", "https://oauth2bin.org")
+		query.Set("response_type", "code")
+		if test.challenge != "" {
+			query.Set("code_challenge", test.challenge)
+			query.Set("code_challenge_method", "S256")
+		}
+
+		w := httptest.NewRecorder()
+		handleAuth(w, httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil))
+
+		rejected := strings.Contains(w.Header().Get("Location"), "error=invalid_request")
+		if rejected != test.rejected || (!rejected && w.Code != http.StatusOK) {
+			t.Errorf("%s with challenge %q: HTTP %d, redirected to %q", test.clientID, test.challenge, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+// Changes to the root of the repository, from which the templates are read.
+// Returns a function which changes back to this package.
+func chdirRepositoryRoot(t *testing.T) func() {
+	err := os.Chdir("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		os.Chdir("oauth2/server")
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// Prefix of the cookies which bind authorization requests to the user-agent.
+// Every request has its own cookie, so that several may be pending at once.
+const csrfCookiePrefix = "OA2B_CSRF_"
+
+// Stores the validated authorization request and presents the authorization screen for it.
+// The CSRF token of the request is set as a cookie, so that the request can only be
+// completed by the user-agent the screen was presented to.
+func presentAuthScreen(w http.ResponseWriter, r *http.Request, request *cache.AuthRequest) {
+	requestID, csrfToken, err := cache.NewAuthRequest(*request)
+	if err != nil {
+		log.Println(err)
+		if request.RedirectURI != "" {
+			redirectAuthError(w, r, request, "server_error", "Please try again.")
+		} else {
+			utils.ShowError(w, r, http.StatusInternalServerError, "Internal Server Error", "Please try again.")
+		}
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookiePrefix + requestID,
+		Value:    csrfToken,
+		Path:     "/response",
+		MaxAge:   cache.AuthRequestLifetime,
+		Secure:   isSecureRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	utils.PresentAuthScreen(w, r, request.Flow, requestID, serverConfig.DescribeScope(request.Scope))
+}
+
+// Looks up the authorization request submitted by the authorization screen and removes it.
+// Forged submissions lack the CSRF cookie of the request and are rejected, as are
+// unknown and expired requests. Returns nil if an error has been sent.
+func consumeAuthRequest(w http.ResponseWriter, r *http.Request) *cache.AuthRequest {
+	requestID := r.FormValue("requestID")
+	cookie, err := r.Cookie(csrfCookiePrefix + requestID)
+	if requestID == "" || err != nil {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "Unknown or expired authorization request")
+		return nil
+	}
+
+	request, err := cache.ConsumeAuthRequest(requestID, cookie.Value)
+	if err != nil {
+		log.Println(err)
+		utils.ShowError(w, r, http.StatusInternalServerError, "Internal Server Error", "Please try again.")
+		return nil
+	} else if request == nil {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "Unknown or expired authorization request")
+		return nil
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Path:     "/response",
+		MaxAge:   -1,
+		Secure:   isSecureRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return request
+}
+
+// Checks if the request reached the server, or the proxy in front of it, over HTTPS
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
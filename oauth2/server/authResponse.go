@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// Sends the authorization response by redirecting the user-agent to the redirect URI of the request.
+// The state of the request, if any, is returned along with the parameters.
+// Parameters are added to the query component for the Authorization Code flow, keeping any query
+// the redirect URI already has, and to the fragment component for the Implicit flow.
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.2
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.2.2
+func redirectAuthResponse(w http.ResponseWriter, r *http.Request, request *cache.AuthRequest, params url.Values) {
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+
+	location, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "redirect_uri is invalid")
+		return
+	}
+
+	// The authorization screen is submitted with POST, which must not be repeated at the client
+	status := http.StatusFound
+	if r.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
+
+	if usesFragment(request.ResponseType) {
+		location.Fragment = ""
+		http.Redirect(w, r, location.String()+"#"+params.Encode(), status)
+		return
+	}
+
+	if location.RawQuery != "" {
+		location.RawQuery += "&"
+	}
+	location.RawQuery += params.Encode()
+
+	http.Redirect(w, r, location.String(), status)
+}
+
+// Sends an error response to the client by redirecting the user-agent to the redirect URI.
+// It must only be used once the redirect URI has been validated for the client.
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.2.1
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.2.2.1
+func redirectAuthError(w http.ResponseWriter, r *http.Request, request *cache.AuthRequest, code, desc string) {
+	params := url.Values{}
+	params.Set("error", code)
+	if desc != "" {
+		params.Set("error_description", desc)
+	}
+
+	redirectAuthResponse(w, r, request, params)
+}
+
+// Checks if the response is returned in the fragment component, i.e., if a token is requested
+// directly from the authorization endpoint. Unknown response types use the query component.
+func usesFragment(responseType string) bool {
+	for _, value := range strings.Fields(responseType) {
+		if value == "token" || value == "id_token" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// Extracts the client credentials from the request, as per RFC 6749 Section 2.3.1.
+// The HTTP Basic authentication scheme is preferred and the request body is used
+// as a fallback. The body must already have been parsed with r.ParseForm.
+// Refer: https://tools.ietf.org/html/rfc6749#section-2.3.1
+func getClientCredentials(r *http.Request) (string, string) {
+	if clientID, clientSecret, found := getBasicCredentials(r); found {
+		return clientID, clientSecret
+	}
+
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+// Extracts the credentials of an Authorization header using the Basic scheme, whose name is
+// case-insensitive. Returns false for other schemes, such as Bearer, which do not authenticate the client.
+// Refer: https://tools.ietf.org/html/rfc7617#section-2
+func getBasicCredentials(r *http.Request) (string, string, bool) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) < 6 || !strings.EqualFold(header[:6], "Basic ") {
+		return "", "", false
+	}
+
+	clientID, clientSecret := utils.ParseBasicAuthHeader(header[6:])
+	return clientID, clientSecret, true
+}
+
+// Looks up a client in the server config, falling back to the clients
+// created at the registration endpoint. Returns nil if there is no such client.
+func lookupClient(clientID string) *config.Client {
+	if clientID == "" {
+		return nil
+	}
+
+	if client := serverConfig.FindClient(clientID); client != nil {
+		return client
+	}
+
+	registered, err := cache.GetClient(clientID)
+	if err != nil {
+		log.Println(err)
+		return nil
+	} else if registered == nil {
+		return nil
+	}
+
+	return &registered.Client
+}
+
+// Checks if the credentials belong to a confidential client.
+func authenticateClient(clientID, clientSecret string) bool {
+	client := lookupClient(clientID)
+	return client != nil && !client.IsPublic() && verifyClientSecret(client, clientSecret)
+}
+
+// Checks if the client ID belongs to a public client, i.e., one that
+// cannot hold a secret and only identifies itself with its client ID.
+// Refer: https://tools.ietf.org/html/rfc6749#section-2.1
+func isPublicClient(clientID string) bool {
+	client := lookupClient(clientID)
+	return client != nil && client.IsPublic()
+}
+
+// Looks up a client which may use the grant type.
+// Returns nil if there is no such client.
+func findClient(clientID, grantType string) *config.Client {
+	client := lookupClient(clientID)
+	if client == nil || !client.AllowsGrantType(grantType) {
+		return nil
+	}
+
+	return client
+}
+
+// Checks if every value of the scope is in the scope catalog and was registered for the client.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.3
+func allowsScope(client *config.Client, scope string) bool {
+	return serverConfig.KnowsScope(scope) && client.AllowsScope(scope)
+}
+
+// Checks the secret sent by a client. Public clients have no secret.
+func verifyClientSecret(client *config.Client, clientSecret string) bool {
+	if client.IsPublic() {
+		return clientSecret == ""
+	}
+
+	return subtle.ConstantTimeCompare([]byte(clientSecret), []byte(client.ClientSecret)) == 1
+}
+
+// Authenticates the client at the token endpoint and checks that it may use the grant type.
+// If not, the invalid_client or unauthorized_client error is sent and nil is returned.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.2.1
+func authenticateTokenClient(w http.ResponseWriter, r *http.Request, params map[string]string, grantType string) *config.Client {
+	client := lookupClient(params["client_id"])
+	if client == nil || !verifyClientSecret(client, params["client_secret"]) {
+		showInvalidClient(w, r)
+		return nil
+	}
+
+	if !client.AllowsGrantType(grantType) {
+		showUnauthorizedClient(w, r, grantType)
+		return nil
+	}
+
+	return client
+}
+
+// Checks the redirect URI of an authorization request from the client.
+// If the request has no redirect_uri and the client registered only one, it is used.
+// Errors are shown to the user since the user-agent must not be redirected to an invalid URI.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.1.2.3
+// and https://tools.ietf.org/html/rfc6749#section-4.1.2.1
+// Returns the redirect URI, or false if a response has already been sent.
+func validateRedirectURI(w http.ResponseWriter, r *http.Request, client *config.Client) (string, bool) {
+	redirectURI := r.URL.Query().Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		return client.RedirectURIs[0], true
+	}
+
+	if !client.AllowsRedirectURI(redirectURI) {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "redirect_uri is missing or not registered for this client")
+		return "", false
+	}
+
+	return redirectURI, true
+}
+
+// Responds with the invalid_client error and challenges the client to
+// authenticate using the HTTP Basic authentication scheme.
+// Refer: https://tools.ietf.org/html/rfc6749#section-5.2
+func showInvalidClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="OAuth2Bin"`)
+	utils.ShowJSONError(w, r, http.StatusUnauthorized, utils.RequestError{
+		Error: "invalid_client",
+		Desc:  "client authentication failed",
+	})
+}
+
+// Responds with the unauthorized_client error for clients which may not use the grant type.
+// Refer: https://tools.ietf.org/html/rfc6749#section-5.2
+func showUnauthorizedClient(w http.ResponseWriter, r *http.Request, grantType string) {
+	utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+		Error: "unauthorized_client",
+		Desc:  "the client may not use grant_type=" + grantType,
+	})
+}
+
+// Responds with the invalid_grant error for invalid, expired or revoked authorization grants,
+// resource owner credentials and refresh tokens.
+// Refer: https://tools.ietf.org/html/rfc6749#section-5.2
+func showInvalidGrant(w http.ResponseWriter, r *http.Request, err error) {
+	utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+		Error: "invalid_grant",
+		Desc:  err.Error(),
+	})
+}
+
+// Responds with the server_error error when a token could not be issued
+func showServerError(w http.ResponseWriter, r *http.Request) {
+	utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+		Error: "server_error",
+		Desc:  "Token generation failed. Please try again.",
+	})
+}
+
+// Responds with the invalid_scope error for requests with unknown scopes or exceeding the scope registered for the client.
+// Refer: https://tools.ietf.org/html/rfc6749#section-5.2
+func showInvalidScope(w http.ResponseWriter, r *http.Request) {
+	utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+		Error: "invalid_scope",
+		Desc:  "scope is unknown or exceeds the scope registered for this client",
+	})
+}
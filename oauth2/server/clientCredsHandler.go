@@ -7,30 +7,40 @@ import (
 	"net/http"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
-	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
 )
 
+// Checks if client_id and client_secret belong to a confidential client which may use the flow.
+// If yes, an access token is issued.
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.4.2
 func handleClientCredsToken(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if params["client_id"] != serverConfig.ClientCredsCnfg.ClientID ||
-		params["client_secret"] != serverConfig.ClientCredsCnfg.ClientSecret {
-		utils.ShowJSONError(w, r, 400, utils.RequestError{
-			Error: "invalid_request",
-			Desc:  "client_id and client_secret are missing or invalid",
-		})
+	client := authenticateTokenClient(w, r, params, "client_credentials")
+	if client == nil {
+		return
+	} else if client.IsPublic() {
+		// Only confidential clients may use the flow
+		// Refer: https://tools.ietf.org/html/rfc6749#section-4.4
+		showUnauthorizedClient(w, r, "client_credentials")
+		return
+	}
+
+	if !allowsScope(client, params["scope"]) {
+		showInvalidScope(w, r)
 		return
 	}
 
 	// If everything checks out, issue the token
-	token, err := cache.NewClientCredsToken()
+	token, err := cache.NewClientCredsToken(params["client_id"], params["scope"], client.TokenLifetimes)
+	if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
+	}
+
+	token.AccessToken, err = formatAccessToken(serverConfig.ClientCredsCnfg.AccessToken, token.AccessToken)
 	if err != nil {
 		log.Println(err)
-		if err != nil {
-			utils.ShowJSONError(w, r, 500, utils.RequestError{
-				Error: "Internal Server Error",
-				Desc:  "Token generation failed. Please try again.",
-			})
-			return
-		}
+		showServerError(w, r)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// Response of the device authorization endpoint
+// Refer: https://tools.ietf.org/html/rfc8628#section-3.2
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// handleDeviceAuthorization issues a device code and a user code to the device client.
+// The user enters the user code at the verification URI on another device, while the
+// device polls the token endpoint with the device code.
+// Refer RFC 8628 Section 3.1 (https://tools.ietf.org/html/rfc8628#section-3.1)
+func handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "malformed request body",
+		})
+		return
+	}
+
+	clientID, clientSecret := getClientCredentials(r)
+	client := findClient(clientID, config.DeviceCodeGrantType)
+	if client == nil || !verifyClientSecret(client, clientSecret) {
+		showInvalidClient(w, r)
+		return
+	}
+
+	if !allowsScope(client, r.PostForm.Get("scope")) {
+		showInvalidScope(w, r)
+		return
+	}
+
+	grant, err := cache.NewDeviceGrant(clientID, r.PostForm.Get("scope"))
+	if err != nil {
+		log.Println(err)
+		utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+			Error: "server_error",
+			Desc:  "Device authorization failed. Please try again.",
+		})
+		return
+	}
+
+	verificationURI := serverConfig.BaseURL + "/device"
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	jsonBytes, err := json.Marshal(deviceAuthorizationResponse{
+		DeviceCode:              grant.DeviceCode,
+		UserCode:                grant.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(grant.UserCode),
+		ExpiresIn:               grant.ExpiresIn,
+		Interval:                grant.Interval,
+	})
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
+
+// handleDeviceVerification asks the user for the user code, unless it is already
+// in the query parameters, and then presents the authorization screen.
+// Refer RFC 8628 Section 3.3 (https://tools.ietf.org/html/rfc8628#section-3.3)
+func handleDeviceVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		utils.ShowError(w, r, http.StatusMethodNotAllowed, "Method Not Allowed", r.Method+" not allowed.")
+		return
+	}
+
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		utils.PresentAuthScreen(w, r, config.Device, "", nil)
+		return
+	}
+
+	grant, err := cache.GetDeviceGrant(userCode)
+	if err != nil {
+		log.Println(err)
+		utils.ShowError(w, r, http.StatusInternalServerError, "Internal Server Error", "Please try again.")
+		return
+	}
+
+	if grant == nil {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "Invalid or expired user code")
+		return
+	}
+
+	presentAuthScreen(w, r, &cache.AuthRequest{
+		Flow:     config.Device,
+		ClientID: grant.ClientID,
+		Scope:    grant.Scope,
+		UserCode: grant.UserCode,
+	})
+}
+
+// Invoked by handleResponse when the user approves or denies a device authorization.
+// Since the device is polling for the outcome, no redirect takes place.
+func handleDeviceResponse(w http.ResponseWriter, r *http.Request, request *cache.AuthRequest) {
+	approved := r.FormValue("response") == "ACCEPT"
+	resolved, err := cache.ResolveDeviceGrant(request.UserCode, serverConfig.User.Subject, approved)
+	if err != nil {
+		log.Println(err)
+		utils.ShowError(w, r, http.StatusInternalServerError, "Internal Server Error", "Please try again.")
+		return
+	}
+
+	if !resolved {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "Invalid or expired user code")
+		return
+	}
+
+	if approved {
+		utils.ShowMessage(w, r, "Device connected", "You may now return to your device.")
+	} else {
+		utils.ShowMessage(w, r, "Request denied", "Your device was not connected.")
+	}
+}
+
+// Error codes returned to the polling device, as per RFC 8628 Section 3.5 (https://tools.ietf.org/html/rfc8628#section-3.5)
+var devicePollingErrors = map[error]string{
+	cache.ErrAuthorizationPending: "authorization_pending",
+	cache.ErrSlowDown:             "slow_down",
+	cache.ErrAccessDenied:         "access_denied",
+	cache.ErrExpiredToken:         "expired_token",
+	cache.ErrInvalidDeviceCode:    "invalid_grant",
+}
+
+// handleDeviceToken is invoked when the device polls the token endpoint with the device code.
+// An access token is issued once the user approves the authorization.
+// Refer: https://tools.ietf.org/html/rfc8628#section-3.4
+func handleDeviceToken(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if params["device_code"] == "" {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "device_code is required",
+		})
+		return
+	}
+
+	client := authenticateTokenClient(w, r, params, config.DeviceCodeGrantType)
+	if client == nil {
+		return
+	}
+
+	token, err := cache.NewDeviceToken(params["device_code"], params["client_id"], client.TokenLifetimes)
+	if code, found := devicePollingErrors[err]; found {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: code,
+			Desc:  err.Error(),
+		})
+		return
+	} else if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
+	}
+
+	token.AccessToken, err = formatAccessToken(serverConfig.DeviceCnfg.AccessToken, token.AccessToken)
+	if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	jsonBytes, err := json.Marshal(token)
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/jwt"
+)
+
+// Authorization server metadata as described in RFC 8414 Section 2 (https://tools.ietf.org/html/rfc8414#section-2)
+// and OpenID Connect Discovery Section 3 (https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata).
+// The same metadata is served at both the well-known URIs.
+type serverMetadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint         string   `json:"token_endpoint,omitempty"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint,omitempty"`
+	JWKSURI               string   `json:"jwks_uri,omitempty"`
+	ScopesSupported       []string `json:"scopes_supported,omitempty"`
+	ResponseTypes         []string `json:"response_types_supported"`
+	ResponseModes         []string `json:"response_modes_supported,omitempty"`
+	GrantTypes            []string `json:"grant_types_supported,omitempty"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+
+	RevocationEndpoint       string   `json:"revocation_endpoint,omitempty"`
+	RevocationAuthMethods    []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	IntrospectionEndpoint    string   `json:"introspection_endpoint,omitempty"`
+	IntrospectionAuthMethods []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	CodeChallengeMethods     []string `json:"code_challenge_methods_supported,omitempty"`
+	DeviceAuthEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	RegistrationEndpoint     string   `json:"registration_endpoint,omitempty"`
+
+	SubjectTypes      []string `json:"subject_types_supported,omitempty"`
+	IDTokenSigningAlg []string `json:"id_token_signing_alg_values_supported,omitempty"`
+	ClaimsSupported   []string `json:"claims_supported,omitempty"`
+}
+
+// Authentication methods of confidential clients
+// Refer: https://tools.ietf.org/html/rfc6749#section-2.3.1
+var clientSecretAuthMethods = []string{"client_secret_basic", "client_secret_post"}
+
+// handleDiscovery serves the authorization server metadata.
+// It is built from the server config and the registered routes so that
+// it only advertises the flows and endpoints which are enabled.
+func (s *OA2Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	jsonBytes, err := json.Marshal(s.metadata())
+	if err != nil {
+		log.Println(err)
+	}
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
+
+// Builds the authorization server metadata
+func (s *OA2Server) metadata() serverMetadata {
+	cnfg := s.Config
+	meta := serverMetadata{
+		Issuer:        cnfg.BaseURL,
+		ResponseTypes: cnfg.ResponseTypesSupported(),
+		GrantTypes:    cnfg.GrantTypesSupported(),
+	}
+
+	// Returns the URL of the route if it has been registered
+	endpoint := func(route string) string {
+		if !s.routes[route] {
+			return ""
+		}
+
+		return cnfg.BaseURL + route
+	}
+
+	if len(meta.ResponseTypes) > 0 {
+		meta.AuthorizationEndpoint = endpoint("/authorize")
+		meta.ResponseModes = []string{"query", "fragment"}
+	} else {
+		// response_types_supported is required, even if no response type is supported
+		meta.ResponseTypes = []string{}
+	}
+
+	meta.DeviceAuthEndpoint = endpoint("/device_authorization")
+	meta.RegistrationEndpoint = endpoint("/register")
+
+	if !cnfg.AuthCodeCnfg.Disabled || !cnfg.ROPCCnfg.Disabled || !cnfg.ClientCredsCnfg.Disabled || !cnfg.DeviceCnfg.Disabled {
+		meta.TokenEndpoint = endpoint("/token")
+		meta.TokenAuthMethods = clientSecretAuthMethods
+
+		// Public clients, which may also be registered, only identify themselves
+		if cnfg.HasPublicClient() || meta.RegistrationEndpoint != "" {
+			meta.TokenAuthMethods = append([]string{"none"}, clientSecretAuthMethods...)
+		}
+	}
+
+	if !cnfg.AuthCodeCnfg.Disabled {
+		meta.CodeChallengeMethods = []string{cache.PKCEMethodPlain, cache.PKCEMethodS256}
+	}
+
+	if meta.IntrospectionEndpoint = endpoint("/introspect"); meta.IntrospectionEndpoint != "" {
+		meta.IntrospectionAuthMethods = clientSecretAuthMethods
+	}
+
+	if meta.RevocationEndpoint = endpoint("/revoke"); meta.RevocationEndpoint != "" {
+		meta.RevocationAuthMethods = append([]string{"none"}, clientSecretAuthMethods...)
+	}
+
+	// The keys verify the JWT access tokens as well as the ID tokens
+	if cnfg.IssuesJWTAccessTokens() || meta.AuthorizationEndpoint != "" {
+		meta.JWKSURI = endpoint("/jwks.json")
+	}
+
+	// OpenID Connect is layered on top of the Authorization Code and Implicit flows
+	if meta.AuthorizationEndpoint != "" {
+		meta.UserInfoEndpoint = endpoint("/userinfo")
+		meta.ScopesSupported = []string{OpenIDScope, "profile", "email"}
+		meta.SubjectTypes = []string{"public"}
+		meta.IDTokenSigningAlg = []string{jwt.AlgRS256}
+		meta.ClaimsSupported = []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"name", "given_name", "family_name", "preferred_username", "email", "email_verified",
+		}
+	}
+
+	// The scope catalog is published as is, since clients may not request other scopes
+	if len(cnfg.Scopes) > 0 {
+		meta.ScopesSupported = cnfg.ScopeNames()
+	}
+
+	return meta
+}
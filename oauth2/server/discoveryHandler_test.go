@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
+
+// TestMetadataWithoutAuthorizationEndpoint checks the metadata of a server which only
+// issues tokens at the token endpoint, to public clients as well
+func TestMetadataWithoutAuthorizationEndpoint(t *testing.T) {
+	s := &OA2Server{
+		Config: config.OA2Config{
+			BaseURL:         "https://oauth2bin.org",
+			AuthCodeCnfg:    config.AuthCodeConfig{Disabled: true},
+			ImplicitCnfg:    config.ImplicitConfig{Disabled: true},
+			ClientCredsCnfg: config.ClientCredsConfig{Disabled: true},
+			ROPCCnfg:        config.ROPCConfig{AccessToken: config.AccessTokenConfig{Format: config.TokenFormatJWT}},
+			Clients:         []config.Client{{ClientID: "publicClient", GrantTypes: []string{"password"}}},
+		},
+		routes: map[string]bool{"/token": true, "/jwks.json": true},
+	}
+
+	meta := s.metadata()
+	if meta.AuthorizationEndpoint != "" || meta.JWKSURI != "https://oauth2bin.org/jwks.json" {
+		t.Fatalf("JWKS not published for JWT access tokens: %+v", meta)
+	}
+
+	if len(meta.TokenAuthMethods) == 0 || meta.TokenAuthMethods[0] != "none" {
+		t.Fatalf("Public clients not advertised: %v", meta.TokenAuthMethods)
+	}
+
+	s.Config.ROPCCnfg.AccessToken = config.AccessTokenConfig{}
+	s.Config.Clients[0].ClientSecret = "clientSecret"
+	meta = s.metadata()
+	if meta.JWKSURI != "" || len(meta.TokenAuthMethods) != len(clientSecretAuthMethods) {
+		t.Fatalf("Unexpected metadata without JWTs or public clients: %+v", meta)
+	}
+}
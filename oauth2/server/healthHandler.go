@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+)
+
+// Describes the state of the server
+//
+// Status: that of the store, either ok, degraded or unavailable
+// RateLimiterFailure: whether requests are let through or rejected while the store is unavailable
+// Housekeeping: the stats of the housekeeping tasks run by this replica
+type healthResponse struct {
+	Status             string                    `json:"status"`
+	Store              cache.StoreHealth         `json:"store"`
+	RateLimiterFailure cache.FailurePolicy       `json:"rate_limiter_failure"`
+	Housekeeping       []cache.HousekeepingStats `json:"housekeeping"`
+}
+
+// [Auth Not Required] handleHealth reports whether the server is healthy, degraded
+// or unavailable, so that orchestrators can tell. Responds with HTTP 503 if unavailable.
+func (s *OA2Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	store := cache.CheckStore()
+	response := healthResponse{
+		Status:             store.Status,
+		Store:              store,
+		RateLimiterFailure: s.Limiter.FailurePolicy(),
+		Housekeeping:       cache.GetHousekeepingStats(),
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Println(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if store.Status == cache.StoreUnavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
@@ -1,22 +1,50 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
-	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
 )
 
-func handleImplicitAuth(w http.ResponseWriter, r *http.Request) {
-	queryParams := r.URL.Query()
-	clientID := queryParams.Get("client_id")
-
-	switch clientID {
-	case "":
-		utils.ShowError(w, r, 400, "Bad Request", "client_id is required")
-	case serverConfig.AuthCodeCnfg.ClientID:
-		utils.PresentAuthScreen(w, r, config.Implicit)
-	default:
-		utils.ShowError(w, r, 401, "Unauthorized", "Invalid client_id")
+// handleImplicitAuth checks the OpenID Connect parameters of an authorization request whose
+// client and redirect URI have already been validated.
+// If they are invalid, an invalid_request error is returned.
+// Else, the request is stored and an authorization screen is presented to the user.
+func handleImplicitAuth(w http.ResponseWriter, r *http.Request, request *cache.AuthRequest) {
+	err := validateImplicitRequest(request.ResponseType, request.Scope, request.Nonce)
+	if err != nil {
+		redirectAuthError(w, r, request, "invalid_request", err.Error())
+		return
 	}
+
+	presentAuthScreen(w, r, request)
+}
+
+// Checks the OpenID Connect requirements for the Implicit flow.
+// An ID token may only be requested along with the openid scope and a nonce.
+// Refer: https://openid.net/specs/openid-connect-core-1_0.html#ImplicitAuthRequest
+func validateImplicitRequest(responseType, scope, nonce string) error {
+	if !strings.Contains(normalizeResponseType(responseType), "id_token") {
+		return nil
+	}
+
+	if !utils.ScopeContains(scope, OpenIDScope) {
+		return fmt.Errorf("the openid scope is required for response_type=%s", responseType)
+	} else if nonce == "" {
+		return fmt.Errorf("nonce is required for response_type=%s", responseType)
+	}
+
+	return nil
+}
+
+// Sorts the space-delimited values of response_type since their order is insignificant.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.1.1
+func normalizeResponseType(responseType string) string {
+	values := strings.Fields(responseType)
+	sort.Strings(values)
+	return strings.Join(values, " ")
 }
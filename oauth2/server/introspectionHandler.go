@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// handleIntrospect describes a token issued by any of the flows to an authenticated client.
+// Unknown, expired and invalidated tokens are described as {"active": false}.
+// Refer RFC 7662 Section 2 (https://tools.ietf.org/html/rfc7662#section-2)
+func handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "malformed request body",
+		})
+		return
+	}
+
+	if !authenticateClient(getClientCredentials(r)) {
+		showInvalidClient(w, r)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "token is required",
+		})
+		return
+	}
+
+	info, err := cache.IntrospectToken(resolveAccessToken(token), r.PostForm.Get("token_type_hint"))
+	if err != nil {
+		log.Println(err)
+		utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+			Error: "server_error",
+			Desc:  "Token introspection failed. Please try again.",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	jsonBytes, err := json.Marshal(info)
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/jwt"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// OpenIDScope must be requested by clients wishing to use OpenID Connect
+const OpenIDScope = "openid"
+
+// Lifetime of an ID token in seconds
+const idTokenLifetime = 3600
+
+// Claims of an ID token
+// Refer: https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type idTokenClaims struct {
+	Issuer   string `json:"iss"`
+	Subject  string `json:"sub"`
+	Audience string `json:"aud"`
+	Expiry   int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	AuthTime int64  `json:"auth_time"`
+	Nonce    string `json:"nonce,omitempty"`
+	AtHash   string `json:"at_hash,omitempty"`
+}
+
+// Issues a signed ID token for the client, on behalf of the user who authorized it at 'authTime'.
+// at_hash is included only if an access token is issued alongside.
+func newIDToken(clientID, subject, nonce, accessToken string, authTime time.Time) (string, error) {
+	now := time.Now().Unix()
+	claims := idTokenClaims{
+		Issuer:   serverConfig.BaseURL,
+		Subject:  subject,
+		Audience: clientID,
+		Expiry:   now + idTokenLifetime,
+		IssuedAt: now,
+		AuthTime: authTime.Unix(),
+		Nonce:    nonce,
+	}
+
+	if accessToken != "" {
+		claims.AtHash = jwt.LeftHash(accessToken)
+	}
+
+	return jwt.Sign(jwt.AlgRS256, jwt.TypeJWT, claims)
+}
+
+// Claims returned by the UserInfo endpoint.
+// Only the claims belonging to the scopes granted to the token are populated.
+// Refer: https://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+type userInfoClaims struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// handleUserInfo returns the claims about the user who authorized the access token.
+// The token must be sent as a bearer token and must have been granted the openid scope.
+// Refer: https://openid.net/specs/openid-connect-core-1_0.html#UserInfo
+func handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		utils.ShowJSONError(w, r, http.StatusMethodNotAllowed, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  r.Method + " not allowed",
+		})
+		return
+	}
+
+	token := getBearerToken(r)
+	if token == "" {
+		// Refer: https://tools.ietf.org/html/rfc6750#section-3.1
+		w.Header().Set("WWW-Authenticate", `Bearer realm="OAuth2Bin"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	info, err := cache.IntrospectToken(resolveAccessToken(token), cache.AccessTokenHint)
+	if err != nil {
+		log.Println(err)
+		utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+			Error: "server_error",
+			Desc:  "Token verification failed. Please try again.",
+		})
+		return
+	}
+
+	if !info.Active || info.TokenType == "" {
+		showBearerError(w, r, http.StatusUnauthorized, "invalid_token", "expired or invalid access token")
+		return
+	} else if !utils.ScopeContains(info.Scope, OpenIDScope) || info.Subject == "" {
+		showBearerError(w, r, http.StatusForbidden, "insufficient_scope", "access token was not granted the openid scope")
+		return
+	}
+
+	user := serverConfig.User
+	claims := userInfoClaims{Subject: info.Subject}
+	if utils.ScopeContains(info.Scope, "profile") {
+		claims.Name = user.Name
+		claims.GivenName = user.GivenName
+		claims.FamilyName = user.FamilyName
+		claims.PreferredUsername = user.PreferredUsername
+	}
+
+	if utils.ScopeContains(info.Scope, "email") {
+		claims.Email = user.Email
+		claims.EmailVerified = &user.EmailVerified
+	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	jsonBytes, err := json.Marshal(claims)
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
+
+// handleJWKS publishes the public keys used for signing ID tokens and JWT access tokens
+// Refer: https://tools.ietf.org/html/rfc7517#section-5
+func handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	jsonBytes, err := json.Marshal(jwt.JWKS())
+	if err != nil {
+		log.Println(err)
+	}
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
+
+// Extracts the bearer token from the Authorization header,
+// or the access_token parameter of a form-encoded body.
+// Refer: https://tools.ietf.org/html/rfc6750#section-2
+func getBearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	// Parameters such as charset are allowed along with the media type
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method == http.MethodPost && mediaType == "application/x-www-form-urlencoded" {
+		return r.PostFormValue("access_token")
+	}
+
+	return ""
+}
+
+// Responds with an error in the WWW-Authenticate header as per RFC 6750
+// Refer: https://tools.ietf.org/html/rfc6750#section-3
+func showBearerError(w http.ResponseWriter, r *http.Request, status int, code, desc string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="OAuth2Bin", error="%s", error_description="%s"`, code, desc))
+	utils.ShowJSONError(w, r, status, utils.RequestError{
+		Error: code,
+		Desc:  desc,
+	})
+}
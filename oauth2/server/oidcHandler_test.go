@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGetBearerToken checks that bearer tokens are taken from the Authorization header or a form-encoded body
+func TestGetBearerToken(t *testing.T) {
+	tests := []struct {
+		header      string
+		contentType string
+		body        string
+		token       string
+	}{
+		{"Bearer headerToken", "", "", "headerToken"},
+		{"", "application/x-www-form-urlencoded", "access_token=bodyToken", "bodyToken"},
+		{"", "application/x-www-form-urlencoded; charset=UTF-8", "access_token=bodyToken", "bodyToken"},
+		{"", "application/json", "access_token=bodyToken", ""},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/userinfo", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+
+		if token := getBearerToken(r); token != test.token {
+			t.Errorf("%q, %q: got %q, expected %q", test.header, test.contentType, token, test.token)
+		}
+	}
+}
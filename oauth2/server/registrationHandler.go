@@ -0,0 +1,337 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// Client metadata as sent by clients to the registration endpoint
+// Refer: https://tools.ietf.org/html/rfc7591#section-2
+type clientMetadata struct {
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	ClientName              string   `json:"client_name,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+
+	// Extension: rejects authorization requests of the client without a PKCE code_challenge
+	RequirePKCE bool `json:"require_pkce,omitempty"`
+}
+
+// Client information returned by the registration and client configuration endpoints
+// Refer: https://tools.ietf.org/html/rfc7591#section-3.2.1 and https://tools.ietf.org/html/rfc7592#section-3
+type clientInformation struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   *int64 `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+	clientMetadata
+}
+
+// handleRegister creates a client from the metadata in the JSON body of the request.
+// The response holds the client's credentials and a registration access token for
+// managing it at the client configuration endpoint.
+// Refer RFC 7591 Section 3 (https://tools.ietf.org/html/rfc7591#section-3)
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		utils.ShowJSONError(w, r, http.StatusMethodNotAllowed, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  r.Method + " not allowed",
+		})
+		return
+	}
+
+	var request clientInformation
+	if !decodeClientMetadata(w, r, &request) {
+		return
+	}
+
+	client, reqErr := validateClientMetadata(request.clientMetadata)
+	if reqErr != nil {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, reqErr)
+		return
+	}
+
+	registered, registrationToken, err := cache.RegisterClient(client)
+	if err != nil {
+		log.Println(err)
+		utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+			Error: "server_error",
+			Desc:  "Client registration failed. Please try again.",
+		})
+		return
+	}
+
+	response := newClientInformation(registered)
+	response.RegistrationAccessToken = registrationToken
+	writeClientInformation(w, http.StatusCreated, response)
+}
+
+// handleClientConfiguration lets a registered client read, update or delete its
+// registration at /register/{client_id} using its registration access token.
+// Refer RFC 7592 Section 2 (https://tools.ietf.org/html/rfc7592#section-2)
+func handleClientConfiguration(w http.ResponseWriter, r *http.Request) {
+	clientID := strings.TrimPrefix(r.URL.Path, "/register/")
+	token := getBearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="OAuth2Bin"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Unknown clients are indistinguishable from invalid tokens
+	// Refer: https://tools.ietf.org/html/rfc7592#section-2.1
+	client, err := cache.AuthorizeClientManagement(clientID, token)
+	if err != nil {
+		log.Println(err)
+		utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+			Error: "server_error",
+			Desc:  "Client lookup failed. Please try again.",
+		})
+		return
+	} else if client == nil {
+		showBearerError(w, r, http.StatusUnauthorized, "invalid_token", "invalid registration access token")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeClientInformation(w, http.StatusOK, newClientInformation(client))
+	case http.MethodPut:
+		var request clientInformation
+		if !decodeClientMetadata(w, r, &request) {
+			return
+		}
+
+		// The client ID and secret, if sent, must match the registered ones
+		// Refer: https://tools.ietf.org/html/rfc7592#section-2.2
+		if request.ClientID != client.ClientID ||
+			(request.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(request.ClientSecret), []byte(client.ClientSecret)) != 1) {
+			utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+				Error: "invalid_client_metadata",
+				Desc:  "client_id and client_secret must match the registered values",
+			})
+			return
+		}
+
+		metadata, reqErr := validateClientMetadata(request.clientMetadata)
+		if reqErr != nil {
+			utils.ShowJSONError(w, r, http.StatusBadRequest, reqErr)
+			return
+		}
+
+		client, err = cache.UpdateClient(client.ClientID, metadata)
+		if err != nil || client == nil {
+			log.Println(err)
+			utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+				Error: "server_error",
+				Desc:  "Client update failed. Please try again.",
+			})
+			return
+		}
+
+		writeClientInformation(w, http.StatusOK, newClientInformation(client))
+	case http.MethodDelete:
+		err = cache.DeleteClient(client.ClientID)
+		if err == cache.ErrStoreDegraded {
+			utils.ShowJSONError(w, r, http.StatusServiceUnavailable, utils.RequestError{
+				Error: "temporarily_unavailable",
+				Desc:  "The tokens of the client cannot be revoked at the moment. Please try again.",
+			})
+			return
+		} else if err != nil {
+			log.Println(err)
+			utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
+				Error: "server_error",
+				Desc:  "Client deletion failed. Please try again.",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		utils.ShowJSONError(w, r, http.StatusMethodNotAllowed, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  r.Method + " not allowed",
+		})
+	}
+}
+
+// Decodes the JSON body of a registration request.
+// Returns false if the request was malformed, in which case an error has been sent.
+func decodeClientMetadata(w http.ResponseWriter, r *http.Request, request *clientInformation) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "expecting content type application/json",
+		})
+		return false
+	}
+
+	err := json.NewDecoder(r.Body).Decode(request)
+	if err != nil {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_client_metadata",
+			Desc:  "malformed client metadata: " + err.Error(),
+		})
+		return false
+	}
+
+	return true
+}
+
+// Applies the defaults defined by RFC 7591 to the client metadata and checks
+// that the values are supported by the server and consistent with each other.
+// Refer: https://tools.ietf.org/html/rfc7591#section-2.1
+func validateClientMetadata(meta clientMetadata) (config.Client, *utils.RequestError) {
+	client := config.Client{
+		ClientName:              meta.ClientName,
+		RedirectURIs:            meta.RedirectURIs,
+		GrantTypes:              meta.GrantTypes,
+		ResponseTypes:           meta.ResponseTypes,
+		Scope:                   meta.Scope,
+		TokenEndpointAuthMethod: meta.TokenEndpointAuthMethod,
+		RequirePKCE:             meta.RequirePKCE,
+	}
+
+	invalidMetadata := func(format string, args ...interface{}) *utils.RequestError {
+		return &utils.RequestError{Error: "invalid_client_metadata", Desc: fmt.Sprintf(format, args...)}
+	}
+
+	switch client.TokenEndpointAuthMethod {
+	case "":
+		client.TokenEndpointAuthMethod = config.AuthMethodSecretBasic
+	case config.AuthMethodNone, config.AuthMethodSecretBasic, config.AuthMethodSecretPost:
+	default:
+		return client, invalidMetadata("unsupported token_endpoint_auth_method: %s", client.TokenEndpointAuthMethod)
+	}
+
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{"authorization_code"}
+	}
+
+	for _, grantType := range client.GrantTypes {
+		if !containsString(serverConfig.GrantTypesSupported(), grantType) {
+			return client, invalidMetadata("unsupported grant type: %s", grantType)
+		}
+	}
+
+	if client.IsPublic() && client.AllowsGrantType("client_credentials") {
+		return client, invalidMetadata("public clients cannot use the client_credentials grant")
+	}
+
+	if !serverConfig.KnowsScope(client.Scope) {
+		return client, invalidMetadata("scope is not in the scope catalog: %s", client.Scope)
+	}
+
+	// The response types default to those of the redirect-based grant types
+	if len(client.ResponseTypes) == 0 {
+		if client.AllowsGrantType("authorization_code") {
+			client.ResponseTypes = append(client.ResponseTypes, "code")
+		}
+
+		if client.AllowsGrantType("implicit") {
+			client.ResponseTypes = append(client.ResponseTypes, "token")
+		}
+	}
+
+	for i, responseType := range client.ResponseTypes {
+		responseType = normalizeResponseType(responseType)
+		client.ResponseTypes[i] = responseType
+
+		if !containsString(serverConfig.ResponseTypesSupported(), responseType) {
+			return client, invalidMetadata("unsupported response type: %s", responseType)
+		}
+
+		// Refer: https://tools.ietf.org/html/rfc7591#section-2.1
+		if responseType == "code" && !client.AllowsGrantType("authorization_code") {
+			return client, invalidMetadata("response type code requires the authorization_code grant type")
+		} else if responseType != "code" && !client.AllowsGrantType("implicit") {
+			return client, invalidMetadata("response type %s requires the implicit grant type", responseType)
+		}
+	}
+
+	// Redirect URIs are required for the redirect-based flows
+	// Refer: https://tools.ietf.org/html/rfc7591#section-5
+	if len(client.ResponseTypes) > 0 && len(client.RedirectURIs) == 0 {
+		return client, &utils.RequestError{Error: "invalid_redirect_uri", Desc: "redirect_uris are required"}
+	}
+
+	for _, redirectURI := range client.RedirectURIs {
+		parsed, err := url.Parse(redirectURI)
+		if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+			return client, &utils.RequestError{
+				Error: "invalid_redirect_uri",
+				Desc:  "redirect URIs must be absolute and without a fragment: " + redirectURI,
+			}
+		}
+	}
+
+	return client, nil
+}
+
+func newClientInformation(client *cache.RegisteredClient) clientInformation {
+	info := clientInformation{
+		ClientID:              client.ClientID,
+		ClientSecret:          client.ClientSecret,
+		ClientIDIssuedAt:      client.IssuedAt.Unix(),
+		RegistrationClientURI: serverConfig.BaseURL + "/register/" + client.ClientID,
+		clientMetadata: clientMetadata{
+			RedirectURIs:            client.RedirectURIs,
+			TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+			GrantTypes:              client.GrantTypes,
+			ResponseTypes:           client.ResponseTypes,
+			ClientName:              client.ClientName,
+			Scope:                   client.Scope,
+			RequirePKCE:             client.RequirePKCE,
+		},
+	}
+
+	// Secrets never expire, which is indicated by 0
+	if client.ClientSecret != "" {
+		var never int64
+		info.ClientSecretExpiresAt = &never
+	}
+
+	if info.ResponseTypes == nil {
+		info.ResponseTypes = []string{}
+	}
+
+	return info
+}
+
+func writeClientInformation(w http.ResponseWriter, status int, info clientInformation) {
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	jsonBytes, err := json.Marshal(info)
+	if err != nil {
+		log.Println(err)
+	}
+
+	fmt.Fprintln(w, string(jsonBytes))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
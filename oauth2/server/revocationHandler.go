@@ -0,0 +1,52 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
+)
+
+// handleRevoke invalidates an access or refresh token issued to the client.
+// Confidential clients must authenticate, public clients identify themselves with client_id.
+// As per the RFC, an HTTP 200 response is sent even if the token was invalid or unknown,
+// since the purpose of the request, i.e., making the token unusable, is already achieved.
+// Refer RFC 7009 Section 2 (https://tools.ietf.org/html/rfc7009#section-2)
+func handleRevoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "malformed request body",
+		})
+		return
+	}
+
+	clientID, clientSecret := getClientCredentials(r)
+	if !authenticateClient(clientID, clientSecret) && (clientSecret != "" || !isPublicClient(clientID)) {
+		showInvalidClient(w, r)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "token is required",
+		})
+		return
+	}
+
+	_, err = cache.RevokeToken(resolveAccessToken(token), r.PostForm.Get("token_type_hint"), clientID)
+	if err != nil {
+		log.Println(err)
+		utils.ShowJSONError(w, r, http.StatusServiceUnavailable, utils.RequestError{
+			Error: "temporarily_unavailable",
+			Desc:  "Token revocation failed. Please try again.",
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -2,40 +2,55 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
 )
 
-// Checks if the values for username, password, client_id and client_secret match the server presets.
+// Checks if client_id and client_secret belong to a client which may use the flow,
+// and if the values for username and password match the server presets.
 // If yes, an access token is issued.
 // Refer: https://tools.ietf.org/html/rfc6749#section-4.3.2
 func handleROPCToken(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	if params["username"] != serverConfig.ROPCCnfg.Username ||
-		params["password"] != serverConfig.ROPCCnfg.Password ||
-		params["client_id"] != serverConfig.ROPCCnfg.ClientID ||
-		params["client_secret"] != serverConfig.ROPCCnfg.ClientSecret {
+	if params["username"] == "" || params["password"] == "" {
 		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
 			Error: "invalid_request",
-			Desc:  "username, password, client_id and client_secret are missing or invalid",
+			Desc:  "username and password are required",
 		})
 		return
 	}
 
+	client := authenticateTokenClient(w, r, params, "password")
+	if client == nil {
+		return
+	} else if !allowsScope(client, params["scope"]) {
+		showInvalidScope(w, r)
+		return
+	}
+
+	if params["username"] != serverConfig.ROPCCnfg.Username || params["password"] != serverConfig.ROPCCnfg.Password {
+		showInvalidGrant(w, r, errors.New("invalid username or password"))
+		return
+	}
+
 	// If everything checks out, issue the token
-	token, err := cache.NewROPCToken("")
+	token, err := cache.NewROPCToken(params["client_id"], params["username"], params["scope"], "", client.TokenLifetimes)
 	if err != nil {
 		log.Println(err)
-		if err != nil {
-			utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
-				Error: "Internal Server Error",
-				Desc:  "Token generation failed. Please try again.",
-			})
-			return
-		}
+		showServerError(w, r)
+		return
+	}
+
+	token.AccessToken, err = formatAccessToken(serverConfig.ROPCCnfg.AccessToken, token.AccessToken)
+	if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
@@ -44,26 +59,33 @@ func handleROPCToken(w http.ResponseWriter, r *http.Request, params map[string]s
 	fmt.Fprintln(w, string(jsonBytes))
 }
 
-func handleROPCRefresh(w http.ResponseWriter, r *http.Request, params map[string]string) {
-	// Invalidate previously issued token
-	if cache.ROPCRefreshTokenExists(params["refresh_token"], true) {
-		token, err := cache.NewROPCRefreshToken(params["refresh_token"])
-		if err != nil {
-			utils.ShowJSONError(w, r, http.StatusInternalServerError, utils.RequestError{
-				Error: "Internal Server Error",
-				Desc:  "Token generation failed. Please try again.",
-			})
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
-		jsonBytes, err := json.Marshal(token)
-
-		fmt.Fprintln(w, string(jsonBytes))
-	} else {
+func handleROPCRefresh(w http.ResponseWriter, r *http.Request, params map[string]string, client *config.Client) {
+	// Invalidates the previously issued token, if found
+	token, err := cache.NewROPCRefreshToken(params["refresh_token"], client.ClientID, params["scope"], client.RotateRefreshTokens)
+	if err == cache.ErrInvalidRefreshToken || err == cache.ErrRefreshTokenReused {
+		showInvalidGrant(w, r, err)
+		return
+	} else if err == cache.ErrInvalidScope {
 		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
-			Error: "invalid_refresh_token",
-			Desc:  "expired or invalid refresh token",
+			Error: "invalid_scope",
+			Desc:  err.Error(),
 		})
+		return
+	} else if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
+	}
+
+	token.AccessToken, err = formatAccessToken(serverConfig.ROPCCnfg.AccessToken, token.AccessToken)
+	if err != nil {
+		log.Println(err)
+		showServerError(w, r)
+		return
 	}
+
+	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+	jsonBytes, err := json.Marshal(token)
+
+	fmt.Fprintln(w, string(jsonBytes))
 }
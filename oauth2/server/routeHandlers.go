@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -9,13 +10,17 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/utils"
 )
 
-// Routes the request to a AuthorizationHandler based on the request_type
+// Routes the request to a AuthorizationHandler based on the request_type.
+// Until the client and its redirect URI have been validated, errors are shown to the user.
+// Errors after that are returned to the client by redirecting the user-agent to the redirect URI.
+// Refer: https://tools.ietf.org/html/rfc6749#section-4.1.2.1
 func handleAuth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		utils.ShowError(w, r, 405, "Method Not Allowed", r.Method+" not allowed.")
@@ -23,110 +28,295 @@ func handleAuth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	params := r.URL.Query()
+	clientID := params.Get("client_id")
+	if clientID == "" {
+		utils.ShowError(w, r, 400, "Bad Request", "client_id is required")
+		return
+	}
+
+	client := lookupClient(clientID)
+	if client == nil {
+		utils.ShowError(w, r, 401, "Unauthorized", "Invalid client_id")
+		return
+	}
 
-	// Perform empty checks on the following parameters:
-	// - response_type
-	// - client_id
-	if params.Get("response_type") == "" || params.Get("client_id") == "" {
-		utils.ShowError(w, r, 400, "Bad Request", "response_type and client_id are required.")
+	redirectURI, ok := validateRedirectURI(w, r, client)
+	if !ok {
 		return
 	}
 
-	switch r.URL.Query().Get("response_type") {
+	request := &cache.AuthRequest{
+		ClientID:             client.ClientID,
+		RedirectURI:          redirectURI,
+		RedirectURIDefaulted: params.Get("redirect_uri") == "",
+		ResponseType:         normalizeResponseType(params.Get("response_type")),
+		Scope:                params.Get("scope"),
+		State:                params.Get("state"),
+		Nonce:                params.Get("nonce"),
+	}
+
+	var grantType string
+	switch request.ResponseType {
+	case "":
+		redirectAuthError(w, r, request, "invalid_request", "response_type is required")
+		return
 	case "code":
-		handleAuthCodeAuth(w, r)
-	case "token":
-		handleImplicitAuth(w, r)
+		if serverConfig.AuthCodeCnfg.Disabled {
+			redirectAuthError(w, r, request, "unsupported_response_type", "The Authorization Code flow is disabled")
+			return
+		}
+
+		request.Flow, grantType = config.AuthCode, "authorization_code"
+	case "token", "id_token", "id_token token":
+		if serverConfig.ImplicitCnfg.Disabled {
+			redirectAuthError(w, r, request, "unsupported_response_type", "The Implicit flow is disabled")
+			return
+		}
+
+		request.Flow, grantType = config.Implicit, "implicit"
 	default:
-		utils.ShowError(w, r, http.StatusBadRequest, "Authorization Flow Error", "Unknown response_type: "+r.URL.Query().Get("response_type"))
+		redirectAuthError(w, r, request, "unsupported_response_type", "Unknown response_type: "+params.Get("response_type"))
+		return
+	}
+
+	if !client.AllowsGrantType(grantType) {
+		redirectAuthError(w, r, request, "unauthorized_client", "The client may not use response_type="+params.Get("response_type"))
+		return
+	} else if !allowsScope(client, request.Scope) {
+		redirectAuthError(w, r, request, "invalid_scope", "scope is unknown or exceeds the scope registered for this client")
+		return
+	}
+
+	if request.Flow == config.AuthCode {
+		handleAuthCodeAuth(w, r, request, client)
+	} else {
+		handleImplicitAuth(w, r, request)
 	}
 }
 
-// Invoked by the Authorization Grant screen when the user accepts the authorization request.
-// Extracts the redirect_uri from the JSON body, attaches an authorization grant to it,
-// and redirects the user-agent to that URI.
+// Invoked by the Authorization Grant screen when the user accepts or denies the authorization request.
+// The flow is completed from the authorization request stored when the screen was presented,
+// which is identified by the request ID in the form. An authorization grant or token is
+// attached to the redirect URI of the request and the user-agent is redirected to it.
 func handleResponse(w http.ResponseWriter, r *http.Request) {
-	flow, err := strconv.Atoi(r.FormValue("flow"))
-	if err != nil {
+	request := consumeAuthRequest(w, r)
+	if request == nil {
+		return
+	}
+
+	flow := request.Flow
+	if (flow == config.AuthCode && serverConfig.AuthCodeCnfg.Disabled) ||
+		(flow == config.Implicit && serverConfig.ImplicitCnfg.Disabled) ||
+		(flow == config.Device && serverConfig.DeviceCnfg.Disabled) {
 		utils.ShowError(w, r, 400, "OAuth 2.0 Flow Error", "Unrecognized flow")
 		return
 	}
 
-	response := r.FormValue("response")
-	redirectURI, err := url.QueryUnescape(r.FormValue("redirectURI"))
-	if err != nil {
-		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "Invalid redirect_uri")
+	if flow == config.Device {
+		handleDeviceResponse(w, r, request)
 		return
 	}
 
-	if response == "ACCEPT" {
-		switch flow {
-		case config.AuthCode:
-			redirectURI += "?code=" + cache.NewAuthCodeGrant(redirectURI)
-		case config.Implicit:
-			token, err := cache.NewImplicitToken()
+	// The client may have been removed or updated since the request was made
+	client := resolveResponseClient(flow, request.ClientID, request.RedirectURI)
+	if client == nil {
+		utils.ShowError(w, r, http.StatusBadRequest, "Bad Request", "Invalid client_id or redirect_uri not registered for the client")
+		return
+	}
+
+	if r.FormValue("response") != "ACCEPT" {
+		redirectAuthError(w, r, request, "access_denied", "The user denied the authorization request")
+		return
+	}
+
+	params := url.Values{}
+	switch flow {
+	case config.AuthCode:
+		code, err := cache.NewAuthCodeGrant(cache.AuthCodeGrant{
+			ClientID:             client.ClientID,
+			RedirectURI:          request.RedirectURI,
+			RedirectURIDefaulted: request.RedirectURIDefaulted,
+			Scope:                request.Scope,
+			Nonce:                request.Nonce,
+			Subject:              serverConfig.User.Subject,
+			CodeChallenge:        request.CodeChallenge,
+			CodeChallengeMethod:  request.CodeChallengeMethod,
+			Lifetimes:            client.TokenLifetimes,
+		})
+		if err != nil {
+			log.Println(err)
+			redirectAuthError(w, r, request, "server_error", "Authorization grant generation failed. Please try again.")
+			return
+		}
+
+		params.Set("code", code)
+	case config.Implicit:
+		clientID := client.ClientID
+		subject := serverConfig.User.Subject
+
+		if request.ResponseType != "id_token" {
+			token, err := cache.NewImplicitToken(clientID, subject, request.Scope, client.TokenLifetimes)
 			if err != nil {
-				utils.ShowError(w, r, 500, "Internal Server Error", "Token generation failed. Please try again.")
+				log.Println(err)
+				redirectAuthError(w, r, request, "server_error", "Token generation failed. Please try again.")
 				return
 			}
 
-			redirectURI += fmt.Sprintf("#access_token=%s&token_type=bearer&expires_in=%d", token.AccessToken, token.ExpiresIn)
+			accessToken, err := formatAccessToken(serverConfig.ImplicitCnfg.AccessToken, token.AccessToken)
+			if err != nil {
+				log.Println(err)
+				redirectAuthError(w, r, request, "server_error", "Token generation failed. Please try again.")
+				return
+			}
+
+			params.Set("access_token", accessToken)
+			params.Set("token_type", "bearer")
+			params.Set("expires_in", strconv.Itoa(token.ExpiresIn))
+			params.Set("scope", token.Scope)
 		}
 
-	} else if response == "CANCEL" {
-		redirectURI += "?error=access_denied"
+		if strings.Contains(request.ResponseType, "id_token") {
+			idToken, err := newIDToken(clientID, subject, request.Nonce, params.Get("access_token"), time.Now())
+			if err != nil {
+				log.Println(err)
+				redirectAuthError(w, r, request, "server_error", "Token generation failed. Please try again.")
+				return
+			}
+
+			params.Set("id_token", idToken)
+		}
 	}
 
-	http.Redirect(w, r, redirectURI, http.StatusSeeOther)
+	redirectAuthResponse(w, r, request, params)
+}
+
+// Determines the client on whose behalf the authorization screen was accepted.
+// The client must be allowed to use the flow and must have registered the redirect URI.
+// Returns nil if there is no such client.
+func resolveResponseClient(flow int, clientID, redirectURI string) *config.Client {
+	grantType := "authorization_code"
+	if flow == config.Implicit {
+		grantType = "implicit"
+	}
+
+	client := findClient(clientID, grantType)
+	if client == nil || !client.AllowsRedirectURI(redirectURI) {
+		return nil
+	}
+
+	return client
 }
 
 // Redirects the request to the appropriate flowHandler by checking the 'grant_type' parameter.
 // Refer RFC 6749 Section 4.1.3 (https://tools.ietf.org/html/rfc6749#section-4.1.3)
 // Accepts only POST requests with application/x-www-form-urlencoded body.
+// Errors are sent as per RFC 6749 Section 5.2 (https://tools.ietf.org/html/rfc6749#section-5.2)
 func handleToken(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+	// Responses contain tokens, hence they must not be cached
+	// Refer: https://tools.ietf.org/html/rfc6749#section-5.1
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	params, err := parseTokenRequest(r)
 	if err != nil {
-		utils.ShowJSONError(w, r, 500, "An error occurred while processing your request")
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  err.Error(),
+		})
 		return
 	}
 
+	switch grantType := params["grant_type"]; {
+	case grantType == "":
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "grant_type is required",
+		})
+	case !supportsGrantType(grantType):
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "unsupported_grant_type",
+			Desc:  "grant_type is not supported: " + grantType,
+		})
+	case grantType == "authorization_code":
+		handleAuthCodeToken(w, r, params)
+	case grantType == "password":
+		handleROPCToken(w, r, params)
+	case grantType == "client_credentials":
+		handleClientCredsToken(w, r, params)
+	case grantType == config.DeviceCodeGrantType:
+		handleDeviceToken(w, r, params)
+	case grantType == "refresh_token":
+		handleRefreshToken(w, r, params)
+	}
+}
+
+// Parses the parameters of a token request. Client credentials sent using the HTTP Basic
+// authentication scheme are added as client_id and client_secret, other schemes are ignored.
+// Returns an error if a parameter is repeated or more than one authentication method is used.
+// Refer: https://tools.ietf.org/html/rfc6749#section-2.3
+func parseTokenRequest(r *http.Request) (map[string]string, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	params, err := utils.ParseParams(string(body))
 	if err != nil {
-		log.Println(err)
-		utils.ShowJSONError(w, r, 400, "Expected parameters not found.")
-		return
+		return nil, err
 	}
 
-	if params["client_id"] == "" && params["client_secret"] == "" {
-		clientID, clientSecret := utils.ParseBasicAuthHeader(r.Header.Get("Authorization"))
+	if clientID, clientSecret, found := getBasicCredentials(r); found {
+		if _, found := params["client_secret"]; found {
+			return nil, errors.New("the client must not use more than one authentication method")
+		}
+
+		if id, found := params["client_id"]; found && id != clientID {
+			return nil, errors.New("client_id does not match the Authorization header")
+		}
+
 		params["client_id"] = clientID
 		params["client_secret"] = clientSecret
 	}
 
-	switch params["grant_type"] {
-	case "authorization_code":
-		handleAuthCodeToken(w, r, params)
-	case "password":
-		handleROPCToken(w, r, params)
-	case "client_credentials":
-		handleClientCredsToken(w, r, params)
-	case "refresh_token":
-		if len(params["refresh_token"]) != 72 {
-			utils.ShowJSONError(w, r, 400, utils.RequestError{
-				Error: "invalid_request",
-				Desc:  "refresh_token missing or invalid",
-			})
-			return
-		}
+	return params, nil
+}
+
+// Refer RFC 6749 Section 6 (https://tools.ietf.org/html/rfc6749#section-6)
+func handleRefreshToken(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	if params["refresh_token"] == "" {
+		utils.ShowJSONError(w, r, http.StatusBadRequest, utils.RequestError{
+			Error: "invalid_request",
+			Desc:  "refresh_token is required",
+		})
+		return
+	}
+
+	client := authenticateTokenClient(w, r, params, "refresh_token")
+	if client == nil {
+		return
+	} else if !allowsScope(client, params["scope"]) {
+		showInvalidScope(w, r)
+		return
+	}
 
-		if strings.HasPrefix(params["refresh_token"], cache.AuthCodeFlowID) {
-			handleAuthCodeRefresh(w, r, params)
-		} else if strings.HasPrefix(params["refresh_token"], cache.ROPCFlowID) {
-			handleROPCRefresh(w, r, params)
+	if strings.HasPrefix(params["refresh_token"], cache.AuthCodeFlowID) && supportsGrantType("authorization_code") {
+		handleAuthCodeRefresh(w, r, params, client)
+	} else if strings.HasPrefix(params["refresh_token"], cache.ROPCFlowID) && supportsGrantType("password") {
+		handleROPCRefresh(w, r, params, client)
+	} else {
+		showInvalidGrant(w, r, cache.ErrInvalidRefreshToken)
+	}
+}
+
+// Checks if the flow of the grant type is enabled in the server config
+func supportsGrantType(grantType string) bool {
+	for _, supported := range serverConfig.GrantTypesSupported() {
+		if grantType == supported && grantType != "implicit" {
+			return true
 		}
-	default:
-		utils.ShowJSONError(w, r, 400, "grant_type absent or invalid")
 	}
+
+	return false
 }
 
 type echoResponse struct {
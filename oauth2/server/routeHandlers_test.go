@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestParseTokenRequest checks that client credentials are only taken from Basic Authorization headers
+func TestParseTokenRequest(t *testing.T) {
+	tests := []struct {
+		header       string
+		body         string
+		clientID     string
+		clientSecret string
+		invalid      bool
+	}{
+		{"Basic Y2xpZW50SUQ6Y2xpZW50U2VjcmV0", "grant_type=client_credentials", "clientID", "clientSecret", false},
+		{"basic Y2xpZW50SUQ6Y2xpZW50U2VjcmV0", "grant_type=client_credentials", "clientID", "clientSecret", false},
+		{"Bearer someAccessToken", "grant_type=refresh_token&client_id=publicClientID", "publicClientID", "", false},
+		{"", "grant_type=refresh_token&client_id=publicClientID", "publicClientID", "", false},
+		{"Basic Y2xpZW50SUQ6Y2xpZW50U2VjcmV0", "grant_type=client_credentials&client_id=otherClientID", "", "", true},
+		{"Basic Y2xpZW50SUQ6Y2xpZW50U2VjcmV0", "grant_type=client_credentials&client_secret=clientSecret", "", "", true},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+
+		params, err := parseTokenRequest(r)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%q, %q: accepted", test.header, test.body)
+			}
+			continue
+		}
+
+		if err != nil || params["client_id"] != test.clientID || params["client_secret"] != test.clientSecret {
+			t.Errorf("%q, %q: parsed as %q, %q: %v", test.header, test.body, params["client_id"], params["client_secret"], err)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
 	"io/ioutil"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/RohitAwate/OAuth2Bin/oauth2/cache"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+	"github.com/RohitAwate/OAuth2Bin/oauth2/jwt"
 	"github.com/RohitAwate/OAuth2Bin/oauth2/middleware"
 )
 
@@ -24,6 +26,9 @@ type OA2Server struct {
 	Port    string
 	Config  config.OA2Config
 	Limiter middleware.RateLimiter
+
+	// Routes registered with setupRoutes
+	routes map[string]bool
 }
 
 var serverConfig config.OA2Config
@@ -32,12 +37,19 @@ var serverConfig config.OA2Config
 // on the specified port with the specified configuration
 func NewOA2Server(port string, serverConfigPath string, ratePoliciesPath string) *OA2Server {
 	serverConfig = *getServerConfig(serverConfigPath)
+
+	err := jwt.SetupKeys(serverConfig.Keys, serverConfig.SigningAlgs()...)
+	if err != nil {
+		log.Fatal("Could not set up signing keys: " + err.Error())
+	}
+
 	return &OA2Server{
 		Port:   port,
 		Config: serverConfig,
 		Limiter: middleware.RateLimiter{
 			Policies: getRatePolicies(ratePoliciesPath),
 		},
+		routes: make(map[string]bool),
 	}
 }
 
@@ -64,6 +76,7 @@ func (s *OA2Server) chainCommonMiddleware(pattern string, handler http.HandlerFu
 	middlewareSlice = append(middlewareSlice, extras...)
 	chain := middleware.Chain(handler, middlewareSlice...)
 	http.HandleFunc(pattern, chain)
+	s.routes[pattern] = true
 }
 
 func (s *OA2Server) setupRoutes() {
@@ -74,7 +87,21 @@ func (s *OA2Server) setupRoutes() {
 	s.chainCommonMiddleware("/authorize", handleAuth)
 	s.chainCommonMiddleware("/response", handleResponse, middleware.NewPostFormValidator(true))
 	s.chainCommonMiddleware("/token", handleToken, middleware.NewPostFormValidator(false))
+	s.chainCommonMiddleware("/introspect", handleIntrospect, middleware.NewPostFormValidator(false))
+	s.chainCommonMiddleware("/revoke", handleRevoke, middleware.NewPostFormValidator(false))
+	if !s.Config.DeviceCnfg.Disabled {
+		s.chainCommonMiddleware("/device_authorization", handleDeviceAuthorization, middleware.NewPostFormValidator(false))
+		s.chainCommonMiddleware("/device", handleDeviceVerification)
+	}
+
+	s.chainCommonMiddleware("/register", handleRegister)
+	s.chainCommonMiddleware("/register/", handleClientConfiguration)
+	s.chainCommonMiddleware("/userinfo", handleUserInfo)
+	s.chainCommonMiddleware("/jwks.json", handleJWKS)
+	s.chainCommonMiddleware("/.well-known/oauth-authorization-server", s.handleDiscovery)
+	s.chainCommonMiddleware("/.well-known/openid-configuration", s.handleDiscovery)
 	s.chainCommonMiddleware("/echo", handleEcho)
+	s.chainCommonMiddleware("/healthz", s.handleHealth)
 }
 
 // Serves the home page
@@ -111,7 +138,7 @@ func setupGracefulShutdown() {
 // Listens for OS signals and executes the shutdown logic
 func onStopServer() {
 	<-osSignal
-	cache.ClosePool()
+	cache.CloseStore()
 	os.Exit(0)
 }
 
@@ -168,21 +195,25 @@ func getRatePolicies(ratePoliciesPath string) []middleware.RatePolicy {
 	}
 
 	// First, attempts to parse those contents as JSON.
-	// If it works, returns the policies.
 	policies, err := parseJSONPolicies(data)
-	if err == nil {
-		return policies
-	}
+	if err != nil {
+		// Rewinding the file read pointer since the file may
+		// already be consumed till the end by parseJSONPolicies.
+		fd.Seek(0, io.SeekStart)
 
-	// Rewinding the file read pointer since the file may
-	// already be consumed till the end by parseJSONPolicies.
-	fd.Seek(0, io.SeekStart)
+		// Attempts to parse the file as CSV
+		policies, err = parseCSVPolicies(fd)
+		if err != nil {
+			log.Println("Unknown format for rate policies. JSON or CSV supported.")
+			return nil
+		}
+	}
 
-	// Attempts to parse the file as CSV
-	policies, err = parseCSVPolicies(fd)
-	if err != nil {
-		log.Println("Unknown format for rate policies. JSON or CSV supported.")
-		return nil
+	for _, policy := range policies {
+		err = policy.Validate()
+		if err != nil {
+			log.Fatalf("Invalid rate policy for %s: %s", policy.Route, err.Error())
+		}
 	}
 
 	return policies
@@ -201,21 +232,27 @@ func parseJSONPolicies(data []byte) ([]middleware.RatePolicy, error) {
 
 // Tries to parse the given data into an array of policies assuming that the format is CSV
 func parseCSVPolicies(fd *os.File) ([]middleware.RatePolicy, error) {
-	lines, err := csv.NewReader(fd).ReadAll()
+	reader := csv.NewReader(fd)
+	reader.FieldsPerRecord = -1 // The algorithm and the burst may be left out of some lines
+	lines, err := reader.ReadAll()
 	if err != nil {
 		return nil, err
 	}
 
 	policies := make([]middleware.RatePolicy, len(lines))
 	for i, line := range lines {
+		if len(line) < 3 {
+			return nil, fmt.Errorf("expected route, limit and minutes on line %d", i+1)
+		}
+
 		limit, err := strconv.Atoi(strings.TrimSpace(line[1]))
 		if err != nil {
-			log.Fatalf("Expect integer value for policy rate limit: %s" + err.Error())
+			log.Fatalf("Expect integer value for policy rate limit: %s", err.Error())
 		}
 
 		minutes, err := strconv.Atoi(strings.TrimSpace(line[2]))
 		if err != nil {
-			log.Fatalf("Expect integer value for policy time limit: %s" + err.Error())
+			log.Fatalf("Expect integer value for policy time limit: %s", err.Error())
 		}
 
 		policies[i] = middleware.RatePolicy{
@@ -223,6 +260,17 @@ func parseCSVPolicies(fd *os.File) ([]middleware.RatePolicy, error) {
 			Limit:   limit,
 			Minutes: minutes,
 		}
+
+		if len(line) > 3 {
+			policies[i].Algorithm = cache.RateAlgorithm(strings.TrimSpace(line[3]))
+		}
+
+		if len(line) > 4 {
+			policies[i].Burst, err = strconv.Atoi(strings.TrimSpace(line[4]))
+			if err != nil {
+				log.Fatalf("Expect integer value for policy burst: %s", err.Error())
+			}
+		}
 	}
 
 	return policies, nil
@@ -6,68 +6,28 @@ import (
 	"fmt"
 	"html/template"
 	"log"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
-)
-
-var scopeList = []string{
-	"Fly to Mars", "Travel back in time", "Ride a dragon",
-	"Go the center of the Earth", "Be Batman", "Run faster than light",
-	"Live forever", "Be invisible", "Summon a genie",
-	"Discover a lost city", "Stop global warming", "See into the future",
-}
-
-// Returns a string slice containing 'count' number of
-// unique strings selected at random from scopeList.
-func getRandomUniqueScopes(count int) []string {
-	if count >= len(scopeList) {
-		return scopeList
-	}
-
-	// Create Go's equivalent of a set to store the unique indices
-	// of the strings to be selected from scopeList
-	var indices = make(map[int]struct{})
-
-	// Loop until we have 'count' number of unique indices
-	for {
-		// Select a random index
-		r := rand.Int() % len(scopeList)
 
-		// Check if it has already been added to the set
-		if _, found := indices[r]; !found {
-			// If not, add it to the set
-			indices[r] = struct{}{}
-
-			// Stop if we have 'count' number of indices
-			if len(indices) >= count {
-				break
-			}
-		}
-	}
-
-	// Generate a string slice with the scope strings
-	// corresponding to the generated unique indices
-	var scopes = make([]string, count)
-	i := 0
-	for j := range indices {
-		scopes[i] = scopeList[j]
-		i = i + 1
-	}
-
-	return scopes
-}
+	"github.com/RohitAwate/OAuth2Bin/oauth2/config"
+)
 
-// PresentAuthScreen shows the authorization screen to the user
-func PresentAuthScreen(w http.ResponseWriter, r *http.Request, flow int) {
+// PresentAuthScreen shows the authorization screen to the user along with the requested scopes.
+// The form only carries the ID of the authorization request, which is stored server-side.
+// In the Device flow, the user is asked for the user code first if it is not in the request.
+func PresentAuthScreen(w http.ResponseWriter, r *http.Request, flow int, requestID string, scopes []config.ScopeConfig) {
 	authScreenStruct := struct {
-		ScopeList []string
-		Flow      int
+		Scopes    []config.ScopeConfig
+		RequestID string
+		Device    bool
+		UserCode  string
 	}{
-		ScopeList: getRandomUniqueScopes(3),
-		Flow:      flow,
+		Scopes:    scopes,
+		RequestID: requestID,
+		Device:    flow == config.Device,
+		UserCode:  r.URL.Query().Get("user_code"),
 	}
 
 	tmpl, err := template.ParseFiles(
@@ -106,10 +66,31 @@ func ShowError(w http.ResponseWriter, r *http.Request, status int, title string,
 	}
 }
 
+// ShowMessage presents a message screen to the user,
+// for example, when a flow completes without a redirect.
+func ShowMessage(w http.ResponseWriter, r *http.Request, title string, desc string) {
+	tmpl, err := template.ParseFiles(
+		"public/templates/message.html",
+		"public/templates/nav.html",
+		"public/templates/footer.html",
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = tmpl.ExecuteTemplate(w, "message", struct {
+		Title string
+		Desc  string
+	}{Title: title, Desc: desc})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 // RequestError is used as response for failed requests.
 // Using the necessary structures mentioned in RFC 6749 Section 4.1.2.1 (https://tools.ietf.org/html/rfc6749#section-4.1.2.1)
 // error_uri is ignored since this is not a real API and has no documentation.
-// state is ignored because it is ignored by flowHandlers.
+// state only applies to authorization errors, which are redirected to the client instead.
 type RequestError struct {
 	Error string `json:"error"`
 	Desc  string `json:"error_description"`
@@ -127,7 +108,7 @@ func ShowJSONError(w http.ResponseWriter, r *http.Request, status int, data inte
 
 	w.Header().Set("Content-Type", "application/json;charset=UTF-8")
 	w.WriteHeader(status)
-	fmt.Fprintf(w, string(body))
+	fmt.Fprint(w, string(body))
 }
 
 // RenderTemplate renders the template with the given template, sets the status code for the response
@@ -141,31 +122,49 @@ func RenderTemplate(w http.ResponseWriter, r *http.Request, templateName string,
 	template.Execute(w, data)
 }
 
-// ParseParams parses a URL string containing application/x-www-urlencoded
-// parameters and returns a map of string key-value pairs of the same
+// ParseParams parses a URL string containing application/x-www-form-urlencoded
+// parameters and returns a map of string key-value pairs of the same.
+// Pairs are split before they are unescaped, hence values may contain escaped '=' and '&'.
+// Parameters must not be repeated, as per RFC 6749 Section 3.1 (https://tools.ietf.org/html/rfc6749#section-3.1)
 func ParseParams(str string) (map[string]string, error) {
-	str, err := url.QueryUnescape(str)
-	if err != nil {
-		return nil, err
-	}
-
-	if strings.Contains(str, "?") {
-		str = strings.Split(str, "?")[1]
+	// Strips the URL preceding the parameters, if any
+	if i := strings.Index(str, "?"); i != -1 && !strings.Contains(str[:i], "=") {
+		str = str[i+1:]
 	}
 
 	if !strings.Contains(str, "=") {
 		return nil, fmt.Errorf("\"%s\" contains no key-value pairs", str)
 	}
 
+	values, err := url.ParseQuery(str)
+	if err != nil {
+		return nil, err
+	}
+
 	pairs := make(map[string]string)
-	for _, pair := range strings.Split(string(str), "&") {
-		items := strings.Split(pair, "=")
-		pairs[items[0]] = items[1]
+	for key, value := range values {
+		if len(value) > 1 {
+			return nil, fmt.Errorf("%s must not be repeated", key)
+		}
+
+		pairs[key] = value[0]
 	}
 
 	return pairs, nil
 }
 
+// ScopeContains checks if the space-delimited scope string contains the scope value.
+// Refer: https://tools.ietf.org/html/rfc6749#section-3.3
+func ScopeContains(scope, value string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == value {
+			return true
+		}
+	}
+
+	return false
+}
+
 // ParseBasicAuthHeader decodes the Basic Auth header.
 // First checks if the string contains the substring "Basic"
 // and strips it off if present.
@@ -187,13 +186,25 @@ func ParseBasicAuthHeader(header string) (string, string) {
 		return "", ""
 	}
 
-	str := string(bytes)
-	pair := strings.Split(str, ":")
+	// The password may contain colons, but the username may not
+	pair := strings.SplitN(string(bytes), ":", 2)
 	if len(pair) != 2 {
 		return "", ""
 	}
 
-	return pair[0], pair[1]
+	// Client credentials are form-encoded before they are placed in the header
+	// Refer: https://tools.ietf.org/html/rfc6749#section-2.3.1
+	username, err := url.QueryUnescape(pair[0])
+	if err != nil {
+		return "", ""
+	}
+
+	password, err := url.QueryUnescape(pair[1])
+	if err != nil {
+		return "", ""
+	}
+
+	return username, password
 }
 
 // Clearln clears the last line from the console output
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/base64"
 	"reflect"
 	"testing"
 )
@@ -37,3 +38,48 @@ func TestParseParams(t *testing.T) {
 	t.Run("No queries", testParseParamsFunc("https://cloud.digitalocean.com/v1/oauth/token"))
 	t.Run("No queries with leading ?", testParseParamsFunc("https://cloud.digitalocean.com/v1/oauth/token?"))
 }
+
+func TestParseParamsEscaping(t *testing.T) {
+	result, err := ParseParams("code=a%3Db%26c&redirect_uri=https%3A%2F%2Fexample.com%2Fcb%3Fx%3D1&scope=read+write")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"code":         "a=b&c",
+		"redirect_uri": "https://example.com/cb?x=1",
+		"scope":        "read write",
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Maps not equal: %v", result)
+	}
+}
+
+func TestParseParamsRepeated(t *testing.T) {
+	if _, err := ParseParams("grant_type=password&scope=a&scope=b"); err == nil {
+		t.Error("Repeated parameter accepted")
+	}
+}
+
+func TestParseBasicAuthHeader(t *testing.T) {
+	// client%3A1:se:cret%25 form-encoded as per RFC 6749 Section 2.3.1
+	id, secret := ParseBasicAuthHeader("Basic " + base64.StdEncoding.EncodeToString([]byte("client%3A1:se:cret%25")))
+	if id != "client:1" || secret != "se:cret%" {
+		t.Errorf("Decoded %s:%s", id, secret)
+	}
+
+	if id, secret = ParseBasicAuthHeader("Bearer abc"); id != "" || secret != "" {
+		t.Errorf("Decoded %s:%s from a Bearer header", id, secret)
+	}
+}
+
+func TestScopeContains(t *testing.T) {
+	if !ScopeContains("openid profile", "openid") || !ScopeContains(" email  openid", "openid") {
+		t.Error("openid not found in scope")
+	}
+
+	if ScopeContains("", "openid") || ScopeContains("openidx profile", "openid") {
+		t.Error("openid found in scope without it")
+	}
+}